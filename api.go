@@ -0,0 +1,34 @@
+package outlook
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Requester performs requests to microsoft's graph api relative to a mailbox, which is all the services need from a Session.
+// It is the seam for faking the api: the services and their calls are concrete types whose requests all go through a Requester,
+// so a Session built on another Requester with NewRequesterSession, such as outlookmock's, runs every call against it instead.
+type Requester interface {
+	Get(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error)
+	Post(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error)
+	Patch(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error)
+	Delete(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error)
+	// Query performs a request of any method with the given query parameters and headers, which is how calls send their requests.
+	Query(ctx context.Context, method, url string, params url.Values, header http.Header, data interface{}, result interface{}) (*http.Response, error)
+}
+
+// SessionAPI the parts of a Session application code uses to reach the services, batch calls and reach other mailboxes, so that a mock
+// such as outlookmock.Session can stand in for it. The services it returns send their requests through its Requester methods.
+type SessionAPI interface {
+	Requester
+	Calendars() *CalendarService
+	Events() *EventService
+	Folders() *FolderService
+	Messages() *MessageService
+	Batch() *BatchCall
+	ForUser(userIDOrUPN string) *Session
+	Mailbox() string
+}
+
+var _ SessionAPI = (*Session)(nil)
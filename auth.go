@@ -0,0 +1,194 @@
+package outlook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultDevicePollInterval the number of seconds between polls for a device login, and the number added to it whenever microsoft asks to slow down.
+const defaultDevicePollInterval = 5
+
+// deviceCodeSecond the length of the seconds microsoft gives a device code's interval and lifetime in, which tests shorten.
+var deviceCodeSecond = time.Second
+
+// AuthCodeOpt functions to configure optional query parameters on an authorization code url.
+type AuthCodeOpt func(url.Values)
+
+// SetAuthCodeChallenge returns an AuthCodeOpt which adds the S256 PKCE code challenge derived from the given verifier.
+func SetAuthCodeChallenge(verifier string) AuthCodeOpt {
+	return func(v url.Values) {
+		v.Set("code_challenge", PKCEChallenge(verifier))
+		v.Set("code_challenge_method", "S256")
+	}
+}
+
+// SetAuthCodePrompt returns an AuthCodeOpt which sets the prompt behavior of the consent page (login, consent, select_account or none).
+func SetAuthCodePrompt(prompt string) AuthCodeOpt {
+	return func(v url.Values) {
+		v.Set("prompt", prompt)
+	}
+}
+
+// SetAuthCodeLoginHint returns an AuthCodeOpt which pre-fills the username on the consent page.
+func SetAuthCodeLoginHint(hint string) AuthCodeOpt {
+	return func(v url.Values) {
+		v.Set("login_hint", hint)
+	}
+}
+
+// SetAuthCodeParam returns an AuthCodeOpt which sets an arbitrary query parameter on the authorization code url.
+func SetAuthCodeParam(key, value string) AuthCodeOpt {
+	return func(v url.Values) {
+		v.Set(key, value)
+	}
+}
+
+// NewPKCEVerifier returns a random code verifier for use with the PKCE extension of the authorization code flow.
+func NewPKCEVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// PKCEChallenge returns the S256 code challenge for the given code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the url of microsoft's consent page which the user should be redirected to in order to start the authorization code flow.
+func (client *Client) AuthCodeURL(state string, opts ...AuthCodeOpt) string {
+	v := url.Values{}
+	v.Set("client_id", client.appID)
+	v.Set("response_type", "code")
+	v.Set("response_mode", "query")
+	v.Set("redirect_uri", client.redirectURI)
+	v.Set("scope", client.scope)
+	if state != "" {
+		v.Set("state", state)
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return fmt.Sprintf("%s?%s", client.authorityURL(client.tenantID, "authorize"), v.Encode())
+}
+
+// Exchange trades the authorization code returned to the client's redirectURI for a set of tokens, returning a Session for the user as well as the raw token response.
+// The verifier should be the same one used with SetAuthCodeChallenge when building the AuthCodeURL, or empty if PKCE was not used.
+func (client *Client) Exchange(ctx context.Context, code, verifier string) (*Session, *RefreshTokenResponse, error) {
+	tokenURL := client.authorityURL(client.tenantID, "token")
+	body := url.Values{}
+	body.Set("client_id", client.appID)
+	if err := client.authenticate(body, tokenURL); err != nil {
+		return nil, nil, err
+	}
+	body.Set("code", code)
+	body.Set("redirect_uri", client.redirectURI)
+	body.Set("scope", client.scope)
+	body.Set("grant_type", "authorization_code")
+	if verifier != "" {
+		body.Set("code_verifier", verifier)
+	}
+
+	tokenRes, err := client.requestToken(ctx, tokenURL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return newSessionFromToken(client, tokenRes), tokenRes, nil
+}
+
+// StartDeviceLogin starts the device code flow, returning the user code and verification uri which should be shown to the user.
+// Once shown, CompleteDeviceLogin should be called to wait for the user to finish signing in.
+func (client *Client) StartDeviceLogin(ctx context.Context) (*DeviceCodeResponse, error) {
+	body := url.Values{}
+	body.Set("client_id", client.appID)
+	body.Set("scope", client.scope)
+
+	var deviceCode DeviceCodeResponse
+	if err := client.postForm(ctx, client.authorityURL(client.tenantID, "devicecode"), body, &deviceCode); err != nil {
+		return nil, err
+	}
+
+	return &deviceCode, nil
+}
+
+// CompleteDeviceLogin polls the token endpoint until the user has finished the device login started with StartDeviceLogin, returning a Session for the user as well as the raw token response.
+// Polling honours the interval given by microsoft, backing off further whenever it is asked to slow down, and stops when ctx is done or the device code expires.
+func (client *Client) CompleteDeviceLogin(ctx context.Context, deviceCode *DeviceCodeResponse) (*Session, *RefreshTokenResponse, error) {
+	body := url.Values{}
+	body.Set("client_id", client.appID)
+	body.Set("device_code", deviceCode.DeviceCode)
+	body.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+
+	interval := time.Duration(deviceCode.Interval) * deviceCodeSecond
+	if interval <= 0 {
+		interval = defaultDevicePollInterval * deviceCodeSecond
+	}
+	var expiry <-chan time.Time
+	if deviceCode.ExpiresIn > 0 {
+		expiryTimer := time.NewTimer(time.Duration(deviceCode.ExpiresIn) * deviceCodeSecond)
+		defer expiryTimer.Stop()
+		expiry = expiryTimer.C
+	}
+
+	for {
+		pollTimer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			pollTimer.Stop()
+			return nil, nil, ctx.Err()
+		case <-expiry:
+			pollTimer.Stop()
+			return nil, nil, ErrDeviceCodeExpired
+		case <-pollTimer.C:
+		}
+
+		tokenRes, err := client.requestToken(ctx, client.authorityURL(client.tenantID, "token"), body)
+		if err == nil {
+			return newSessionFromToken(client, tokenRes), tokenRes, nil
+		}
+
+		statusErr, ok := err.(*ErrStatusCode)
+		if !ok {
+			return nil, nil, err
+		}
+		switch statusErr.ErrorCode {
+		case "authorization_pending":
+		case "slow_down":
+			interval += defaultDevicePollInterval * deviceCodeSecond
+		case "expired_token":
+			return nil, nil, ErrDeviceCodeExpired
+		default:
+			return nil, nil, err
+		}
+	}
+}
+
+// requestToken posts the given form to a microsoft identity token endpoint and returns the decoded token response.
+func (client *Client) requestToken(ctx context.Context, tokenURL string, body url.Values) (*RefreshTokenResponse, error) {
+	var tokenRes RefreshTokenResponse
+	if err := client.postForm(ctx, tokenURL, body, &tokenRes); err != nil {
+		return nil, err
+	}
+	return &tokenRes, nil
+}
+
+// postForm posts the given form to one of microsoft's identity endpoints, binding the response body with v.
+func (client *Client) postForm(ctx context.Context, endpoint string, body url.Values, v interface{}) error {
+	req, err := client.newRequest(ctx, http.MethodPost, endpoint, formMediaType, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Do(ctx, req, v)
+	return err
+}
@@ -0,0 +1,241 @@
+package outlook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedTokenServer answers token requests with the oauth error codes given, in order, repeating the last once they
+// run out. An empty code answers with tokens. It returns the times and forms of the token requests made.
+func scriptedTokenServer(t *testing.T, codes ...string) (*httptest.Server, func() ([]time.Time, []map[string]string)) {
+	var mu sync.Mutex
+	var times []time.Time
+	var forms []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing token request: %v", err)
+		}
+		mu.Lock()
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		code := codes[len(codes)-1]
+		if len(times) < len(codes) {
+			code = codes[len(times)]
+		}
+		times = append(times, time.Now())
+		forms = append(forms, form)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", mediaType)
+		if code == "" {
+			json.NewEncoder(w).Encode(&RefreshTokenResponse{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&TokenErrorResponse{Error: code, ErrorDescription: code})
+	}))
+	return server, func() ([]time.Time, []map[string]string) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), times...), append([]map[string]string(nil), forms...)
+	}
+}
+
+// shortenDeviceCodeSeconds makes the seconds of device code intervals and lifetimes last 10ms for the rest of the test.
+func shortenDeviceCodeSeconds(t *testing.T) {
+	second := deviceCodeSecond
+	deviceCodeSecond = 10 * time.Millisecond
+	t.Cleanup(func() { deviceCodeSecond = second })
+}
+
+func TestCompleteDeviceLogin(t *testing.T) {
+	shortenDeviceCodeSeconds(t)
+	server, requests := scriptedTokenServer(t, "authorization_pending", "slow_down", "authorization_pending", "")
+	defer server.Close()
+	client, err := NewClient(SetClientAppID("app"), SetClientAuthorityHost(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, tokenRes, err := client.CompleteDeviceLogin(context.Background(), &DeviceCodeResponse{DeviceCode: "device", Interval: 1, ExpiresIn: 900})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenRes.AccessToken != "access" || session.auth.refreshToken != "refresh" {
+		t.Errorf("login returned %+v and a session with refresh token %q", tokenRes, session.auth.refreshToken)
+	}
+
+	times, forms := requests()
+	if len(times) != 4 {
+		t.Fatalf("made %d token requests, want two pending, one slow down and one success", len(times))
+	}
+	if forms[0]["grant_type"] != "urn:ietf:params:oauth:grant-type:device_code" || forms[0]["device_code"] != "device" || forms[0]["client_id"] != "app" {
+		t.Errorf("token request form %v", forms[0])
+	}
+	// Slowing down adds five seconds to the one second interval, which is kept for every poll after it
+	for i, want := range []time.Duration{1, 6, 6} {
+		if gap := times[i+1].Sub(times[i]); gap < want*deviceCodeSecond {
+			t.Errorf("poll %d came %v after the last, want at least %v", i+2, gap, want*deviceCodeSecond)
+		}
+	}
+}
+
+func TestCompleteDeviceLoginStops(t *testing.T) {
+	shortenDeviceCodeSeconds(t)
+	tests := []struct {
+		name       string
+		codes      []string
+		deviceCode *DeviceCodeResponse
+		timeout    time.Duration
+		wantErr    error
+	}{
+		{"expired token", []string{"authorization_pending", "expired_token"}, &DeviceCodeResponse{Interval: 1, ExpiresIn: 900}, 0, ErrDeviceCodeExpired},
+		{"expires in", []string{"authorization_pending"}, &DeviceCodeResponse{Interval: 1, ExpiresIn: 5}, 0, ErrDeviceCodeExpired},
+		{"cancelled", []string{"authorization_pending"}, &DeviceCodeResponse{Interval: 1}, 50 * time.Millisecond, context.DeadlineExceeded},
+		{"declined", []string{"authorization_declined"}, &DeviceCodeResponse{Interval: 1, ExpiresIn: 900}, 0, ErrBadRequest},
+	}
+	for _, tt := range tests {
+		server, _ := scriptedTokenServer(t, tt.codes...)
+		client, err := NewClient(SetClientAuthorityHost(server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+		if tt.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+			defer cancel()
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := client.CompleteDeviceLogin(ctx, tt.deviceCode)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: CompleteDeviceLogin() error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: CompleteDeviceLogin() kept polling", tt.name)
+		}
+		server.Close()
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	// The example from appendix B of RFC 7636
+	if got := PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("PKCEChallenge() = %q", got)
+	}
+
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 requires 43 to 128 characters from the unreserved set
+	if len(verifier) != 43 || strings.Trim(verifier, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~") != "" {
+		t.Errorf("NewPKCEVerifier() = %q", verifier)
+	}
+	if other, _ := NewPKCEVerifier(); other == verifier {
+		t.Error("NewPKCEVerifier() returned the same verifier twice")
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	client, err := NewClient(
+		SetClientAppID("app"),
+		SetClientRedirectURI("https://example.com/callback"),
+		SetClientScope("mail.read offline_access"),
+		SetClientTenant("contoso.onmicrosoft.com"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawURL := client.AuthCodeURL("state-1",
+		SetAuthCodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"),
+		SetAuthCodePrompt("select_account"),
+		SetAuthCodeLoginHint("ann@contoso.com"),
+		SetAuthCodeParam("domain_hint", "contoso.com"),
+	)
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint := parsed.Scheme + "://" + parsed.Host + parsed.Path; endpoint != "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/authorize" {
+		t.Errorf("authorize endpoint %s", endpoint)
+	}
+	want := url.Values{
+		"client_id":             {"app"},
+		"response_type":         {"code"},
+		"response_mode":         {"query"},
+		"redirect_uri":          {"https://example.com/callback"},
+		"scope":                 {"mail.read offline_access"},
+		"state":                 {"state-1"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+		"prompt":                {"select_account"},
+		"login_hint":            {"ann@contoso.com"},
+		"domain_hint":           {"contoso.com"},
+	}
+	if got := parsed.Query(); got.Encode() != want.Encode() {
+		t.Errorf("authorize query %s, want %s", got.Encode(), want.Encode())
+	}
+
+	// Without a state or options only the required parameters are sent
+	if query, _ := url.ParseQuery(strings.SplitN(client.AuthCodeURL(""), "?", 2)[1]); query.Has("state") || query.Has("code_challenge") {
+		t.Errorf("authorize query %s holds a state or challenge", query.Encode())
+	}
+}
+
+func TestExchange(t *testing.T) {
+	server, requests := scriptedTokenServer(t, "")
+	defer server.Close()
+	client, err := NewClient(
+		SetClientAppID("app"),
+		SetClientAppSecret("secret"),
+		SetClientRedirectURI("https://example.com/callback"),
+		SetClientAuthorityHost(server.URL),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, tokenRes, err := client.Exchange(context.Background(), "code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenRes.AccessToken != "access" || session.auth.accessToken != "access" || session.auth.refreshToken != "refresh" || session.auth.expiresAt.IsZero() {
+		t.Errorf("exchange returned %+v and a session holding %+v", tokenRes, session.auth.token())
+	}
+
+	_, forms := requests()
+	want := map[string]string{
+		"client_id":     "app",
+		"client_secret": "secret",
+		"code":          "code",
+		"code_verifier": "verifier",
+		"grant_type":    "authorization_code",
+		"redirect_uri":  "https://example.com/callback",
+		"scope":         DefaultAuthScopes,
+	}
+	if len(forms) != 1 || len(forms[0]) != len(want) {
+		t.Fatalf("token requests %v, want one holding %v", forms, want)
+	}
+	for key, value := range want {
+		if forms[0][key] != value {
+			t.Errorf("token request %s = %q, want %q", key, forms[0][key], value)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package outlook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBatchSize the most sub-requests graph accepts in a single $batch request.
+const maxBatchSize = 20
+
+var (
+	// ErrBatchDependency is returned when a batch item depends on an item which was not added to the same batch before it.
+	ErrBatchDependency = fmt.Errorf("batch items can only depend on items added to the same batch before them")
+	// ErrBatchTooLarge is returned when a chain of dependent batch items holds more requests than fit in a single $batch request.
+	ErrBatchTooLarge = fmt.Errorf("a chain of dependent batch items can't hold more than %d requests", maxBatchSize)
+	// ErrBatchNoResponse is the error of a batch item whose sub-request graph left out of the $batch response.
+	ErrBatchNoResponse = fmt.Errorf("no response for the batch item")
+)
+
+// BatchableCall a call which can be queued in a BatchCall, such as an EventGetCall or CalendarDeleteCall.
+type BatchableCall interface {
+	batchRequest() *callRequest
+}
+
+// BatchCall struct allowing for fluent style configuration of calls to the $batch endpoint.
+// Any number of calls can be queued; they are split into as many $batch requests as needed, keeping items which depend on each other together.
+type BatchCall struct {
+	session *Session
+	items   []*BatchItem
+}
+
+// BatchItem a single call queued in a BatchCall, which holds the call's result once the batch has been executed.
+type BatchItem struct {
+	index     int
+	request   *callRequest
+	dependsOn []*BatchItem
+	status    int
+	err       error
+}
+
+// Batch returns a BatchCall builder struct for queuing calls made with this session.
+func (session *Session) Batch() *BatchCall {
+	return &BatchCall{
+		session: session,
+	}
+}
+
+// Add queues the given call in the batch, returning the item which will hold its result.
+func (bc *BatchCall) Add(call BatchableCall) *BatchItem {
+	item := &BatchItem{
+		index:   len(bc.items),
+		request: call.batchRequest(),
+	}
+	bc.items = append(bc.items, item)
+	return item
+}
+
+// DependsOn makes graph execute the item only once the given items, which must have been added to the same batch before it, have succeeded.
+func (bi *BatchItem) DependsOn(items ...*BatchItem) *BatchItem {
+	bi.dependsOn = append(bi.dependsOn, items...)
+	return bi
+}
+
+// Status returns the http status of the item's response, or 0 if the item has not been executed.
+func (bi *BatchItem) Status() int {
+	return bi.status
+}
+
+// Err returns the error the item failed with, which is an *ErrStatusCode for failed responses.
+func (bi *BatchItem) Err() error {
+	return bi.err
+}
+
+// Result returns the item's result, which has the type the call's Do method returns (e.g. *Event for an EventGetCall, or nil for delete calls), along with the item's error.
+// BatchResult returns it with that type.
+func (bi *BatchItem) Result() (interface{}, error) {
+	if bi.err != nil {
+		return nil, bi.err
+	}
+	return bi.request.result, nil
+}
+
+// BatchResult returns the result of the item as the type the call's Do method returns, e.g. BatchResult[*Event](item) for an EventGetCall,
+// along with the item's error. An error is returned if T is not that type.
+func BatchResult[T any](item *BatchItem) (T, error) {
+	var zero T
+	result, err := item.Result()
+	if err != nil {
+		return zero, err
+	}
+	typed, ok := result.(T)
+	if !ok {
+		return zero, fmt.Errorf("batch item result is a %T, not a %T", result, zero)
+	}
+	return typed, nil
+}
+
+// Do executes every queued call, filling in the result of each item. Throttled items, and the items depending on them, are retried individually.
+// The returned error only reports failures of the batch as a whole; the outcome of each call is available from its item.
+func (bc *BatchCall) Do(ctx context.Context) error {
+	chunks, err := bc.chunks()
+	if err != nil {
+		return err
+	}
+	if bc.session.requester != nil {
+		return bc.doEach(ctx)
+	}
+
+	for _, chunk := range chunks {
+		if err := bc.send(ctx, chunk); err != nil {
+			return err
+		}
+	}
+
+	return bc.retryThrottled(ctx)
+}
+
+// chunks splits the batch's items into groups which each fit in a single $batch request, keeping every chain of dependent items in the same group.
+func (bc *BatchCall) chunks() ([][]*BatchItem, error) {
+	group := make([]int, len(bc.items))
+	for i, item := range bc.items {
+		group[i] = i
+		for _, dep := range item.dependsOn {
+			if dep.index >= item.index || bc.items[dep.index] != dep {
+				return nil, ErrBatchDependency
+			}
+			mergeGroups(group, group[dep.index], group[i])
+		}
+	}
+
+	var order []int
+	members := map[int][]*BatchItem{}
+	for i, item := range bc.items {
+		if _, ok := members[group[i]]; !ok {
+			order = append(order, group[i])
+		}
+		members[group[i]] = append(members[group[i]], item)
+	}
+
+	var chunks [][]*BatchItem
+	var current []*BatchItem
+	for _, g := range order {
+		items := members[g]
+		if len(items) > maxBatchSize {
+			return nil, ErrBatchTooLarge
+		}
+		if len(current)+len(items) > maxBatchSize {
+			chunks = append(chunks, current)
+			current = nil
+		}
+		current = append(current, items...)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks, nil
+}
+
+// mergeGroups relabels every item of either group with the lower of the two labels, which is the index of the group's first item.
+func mergeGroups(group []int, a, b int) {
+	if a == b {
+		return
+	}
+	if a > b {
+		a, b = b, a
+	}
+	for i := range group {
+		if group[i] == b {
+			group[i] = a
+		}
+	}
+}
+
+type batchPayload struct {
+	Requests []*batchSubRequest `json:"requests"`
+}
+
+type batchSubRequest struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      interface{}       `json:"body,omitempty"`
+}
+
+type batchResult struct {
+	Responses []*batchSubResponse `json:"responses"`
+}
+
+type batchSubResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// send posts the given items as a single $batch request and records each sub-response on its item.
+func (bc *BatchCall) send(ctx context.Context, items []*BatchItem) error {
+	payload := &batchPayload{}
+	byID := map[string]*BatchItem{}
+	for _, item := range items {
+		id := strconv.Itoa(item.index + 1)
+		byID[id] = item
+
+		path, err := bc.session.requestPath(item.request.path, item.request.params)
+		if err != nil {
+			return err
+		}
+		subRequest := &batchSubRequest{
+			ID:     id,
+			Method: item.request.method,
+			URL:    path,
+		}
+		for _, dep := range item.dependsOn {
+			subRequest.DependsOn = append(subRequest.DependsOn, strconv.Itoa(dep.index+1))
+		}
+		if item.request.body != nil || len(item.request.header) > 0 {
+			subRequest.Headers = map[string]string{}
+		}
+		for key := range item.request.header {
+			subRequest.Headers[key] = item.request.header.Get(key)
+		}
+		if item.request.body != nil {
+			subRequest.Body = item.request.body
+			subRequest.Headers["Content-Type"] = mediaType
+		}
+		payload.Requests = append(payload.Requests, subRequest)
+	}
+
+	var result batchResult
+	if _, err := bc.session.queryPath(ctx, http.MethodPost, "/$batch", nil, len(items), payload, &result); err != nil {
+		return err
+	}
+
+	for _, subResponse := range result.Responses {
+		item, ok := byID[subResponse.ID]
+		if !ok {
+			continue
+		}
+		delete(byID, subResponse.ID)
+		item.status = subResponse.Status
+		header := http.Header{}
+		for key, value := range subResponse.Headers {
+			header.Set(key, value)
+		}
+		if subResponse.Status >= 200 && subResponse.Status < 300 {
+			item.err = nil
+			if item.request.result != nil && len(subResponse.Body) > 0 && string(subResponse.Body) != "null" {
+				item.err = json.Unmarshal(subResponse.Body, item.request.result)
+			}
+			if setter, ok := item.request.result.(serverResponseSetter); ok && item.err == nil {
+				setter.setServerResponse(subResponse.Status, header)
+			}
+			continue
+		}
+		item.err = newErrStatusCode(subResponse.Status, header, subResponse.Body)
+	}
+	for _, item := range byID {
+		item.status = 0
+		item.err = ErrBatchNoResponse
+	}
+	return nil
+}
+
+// retryThrottled waits once for the longest Retry-After of the throttled items, then executes them, and the items which failed because they
+// depend on them, individually and in order.
+func (bc *BatchCall) retryThrottled(ctx context.Context) error {
+	var wait time.Duration
+	throttled := false
+	for _, item := range bc.items {
+		if item.status != http.StatusTooManyRequests {
+			continue
+		}
+		throttled = true
+		if statusErr, ok := item.err.(*ErrStatusCode); ok && statusErr.SuggestedRetryDuration > wait {
+			wait = statusErr.SuggestedRetryDuration
+		}
+	}
+	if !throttled {
+		return nil
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		return err
+	}
+
+	for _, item := range bc.items {
+		switch item.status {
+		case http.StatusTooManyRequests:
+		case http.StatusFailedDependency:
+			if !item.dependenciesSucceeded() {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if err := item.execute(ctx, bc.session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doEach executes the items of a session without a client individually and in order, failing those whose dependencies failed with a
+// 424 as graph would.
+func (bc *BatchCall) doEach(ctx context.Context) error {
+	for _, item := range bc.items {
+		if !item.dependenciesSucceeded() {
+			item.status = http.StatusFailedDependency
+			item.err = newErrStatusCode(http.StatusFailedDependency, nil, nil)
+			continue
+		}
+		if err := item.execute(ctx, bc.session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute sends the item's request on its own, recording its outcome on the item. Only a cancelled context is returned as an error.
+func (bi *BatchItem) execute(ctx context.Context, session *Session) error {
+	res, err := bi.request.do(ctx, session)
+	bi.err = err
+	if statusErr, ok := err.(*ErrStatusCode); ok {
+		bi.status = statusErr.Code
+	} else if res != nil {
+		bi.status = res.StatusCode
+	}
+	return ctx.Err()
+}
+
+func (bi *BatchItem) dependenciesSucceeded() bool {
+	for _, dep := range bi.dependsOn {
+		if dep.err != nil || dep.status < 200 || dep.status >= 300 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package outlook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedBatchServer answers $batch requests by throttling the sub-requests for events whose ids start with throttled and leaving out
+// those whose ids start with missing, and answers individual event gets with the event.
+func scriptedBatchServer(t *testing.T) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var individual []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", mediaType)
+		if strings.HasSuffix(r.URL.Path, "/$batch") {
+			var payload batchPayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("decoding batch: %v", err)
+			}
+			result := batchResult{}
+			for _, req := range payload.Requests {
+				id := req.URL[strings.LastIndex(req.URL, "/")+1:]
+				switch {
+				case strings.HasPrefix(id, "missing"):
+				case strings.HasPrefix(id, "throttled"):
+					result.Responses = append(result.Responses, &batchSubResponse{
+						ID:      req.ID,
+						Status:  http.StatusTooManyRequests,
+						Headers: map[string]string{"Retry-After": "1"},
+						Body:    json.RawMessage(`{"error":{"code":"ApplicationThrottled","message":"slow down"}}`),
+					})
+				default:
+					result.Responses = append(result.Responses, &batchSubResponse{ID: req.ID, Status: http.StatusOK, Body: json.RawMessage(`{"id":"` + id + `"}`)})
+				}
+			}
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+		mu.Lock()
+		individual = append(individual, r.URL.Path)
+		mu.Unlock()
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		w.Write([]byte(`{"id":"` + id + `"}`))
+	}))
+	return server, &individual
+}
+
+func TestBatchRetriesThrottledItemsAfterOneWait(t *testing.T) {
+	server, individual := scriptedBatchServer(t)
+	defer server.Close()
+	client, err := NewClient(SetClientGraphHost(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "token"})
+
+	batch := session.Batch()
+	ok := batch.Add(session.Events().Get("primary", "event-1"))
+	first := batch.Add(session.Events().Get("primary", "throttled-1"))
+	second := batch.Add(session.Events().Get("primary", "throttled-2"))
+
+	start := time.Now()
+	if err := batch.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Both items asked to wait a second, which should be waited once rather than once per item
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed >= 2*time.Second {
+		t.Errorf("batch took %v, want a single one second wait", elapsed)
+	}
+	if len(*individual) != 2 {
+		t.Errorf("retried %v individually, want both throttled items", *individual)
+	}
+
+	for _, item := range []*BatchItem{ok, first, second} {
+		event, err := BatchResult[*Event](item)
+		if err != nil {
+			t.Fatalf("BatchResult: %v", err)
+		}
+		if item.Status() != http.StatusOK || event.ID == "" {
+			t.Errorf("item has status %d and event %+v, want a fetched event", item.Status(), event)
+		}
+	}
+	if _, err := BatchResult[*Calendar](ok); err == nil {
+		t.Error("BatchResult of the wrong type succeeded")
+	}
+}
+
+func TestBatchItemWithoutResponseFails(t *testing.T) {
+	server, _ := scriptedBatchServer(t)
+	defer server.Close()
+	client, err := NewClient(SetClientGraphHost(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "token"})
+
+	batch := session.Batch()
+	batch.Add(session.Events().Get("primary", "event-1"))
+	missing := batch.Add(session.Events().Get("primary", "missing-1"))
+	if err := batch.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Result(); err != ErrBatchNoResponse {
+		t.Errorf("Result() error = %v, want ErrBatchNoResponse", err)
+	}
+}
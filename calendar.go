@@ -3,19 +3,24 @@ package outlook
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/amhester/go-outlook/odata"
 )
 
 // CalendarService manages communication with microsofts graph for calendar resources.
 type CalendarService struct {
-	session  *Session
-	basePath string
+	requester Requester
+	basePath  string
 }
 
 // NewCalendarService returns a new instance of a CalendarService.
-func NewCalendarService(session *Session) *CalendarService {
+func NewCalendarService(requester Requester) *CalendarService {
 	return &CalendarService{
-		session:  session,
-		basePath: "/calendars",
+		requester: requester,
+		basePath:  "/calendars",
 	}
 }
 
@@ -24,6 +29,8 @@ type CalendarListCall struct {
 	service    *CalendarService
 	nextLink   string
 	maxResults int64
+	limit      int
+	query      odata.Query
 }
 
 // List returns a CalendarListCall builder struct
@@ -40,34 +47,85 @@ func (clc *CalendarListCall) MaxResults(pageSize int64) *CalendarListCall {
 	return clc
 }
 
-// NextLink uses the link provided to set the $skip query parameter for the calendar list call.
+// NextLink sets the link of the page to fetch, as returned in the NextLink of a previous result, which is followed verbatim.
 func (clc *CalendarListCall) NextLink(link string) *CalendarListCall {
 	clc.nextLink = link
 	return clc
 }
 
+// Filter sets the $filter query parameter for the calendar list call, e.g. odata.Field("name").StartsWith("Team").
+func (clc *CalendarListCall) Filter(filter odata.Expr) *CalendarListCall {
+	clc.query.Filter = filter
+	return clc
+}
+
+// OrderBy sets the $orderby query parameter for the calendar list call, e.g. odata.Field("name").Asc().
+func (clc *CalendarListCall) OrderBy(orders ...odata.Order) *CalendarListCall {
+	clc.query.OrderBy = orders
+	return clc
+}
+
+// Select sets the $select query parameter for the calendar list call, limiting the properties returned for each calendar.
+func (clc *CalendarListCall) Select(fields ...string) *CalendarListCall {
+	clc.query.Select = fields
+	return clc
+}
+
+// Expand sets the $expand query parameter for the calendar list call, including the given relationships of each calendar.
+func (clc *CalendarListCall) Expand(relationships ...string) *CalendarListCall {
+	clc.query.Expand = relationships
+	return clc
+}
+
 // Do executes the calendar list call, returning the calendar list result.
 func (clc *CalendarListCall) Do(ctx context.Context) (*CalendarListResult, error) {
-	params := map[string]interface{}{
-		"$top":   clc.maxResults,
-		"$count": true,
-	}
-	if clc.nextLink != "" {
-		params["$skip"] = parsePageLink(clc.nextLink, "$skip")
-	}
-
 	var result CalendarListResult
-	if _, err := clc.service.session.Get(ctx, clc.service.basePath, params, &result); err != nil {
+	if _, err := clc.request(&result).do(ctx, clc.service.requester); err != nil {
 		return nil, err
 	}
 
 	return &result, nil
 }
 
+// Limit caps the number of calendars All collects. Zero, the default, collects every calendar.
+func (clc *CalendarListCall) Limit(limit int) *CalendarListCall {
+	clc.limit = limit
+	return clc
+}
+
+// Pages executes the calendar list call and follows every next link, calling fn with each page of results until there are none left or fn returns an error.
+func (clc *CalendarListCall) Pages(ctx context.Context, fn func(*CalendarListResult) error) error {
+	call := *clc
+	return pages(ctx, call.Do, func(nextLink string) { call.nextLink = nextLink }, fn)
+}
+
+// All executes the calendar list call and follows every next link, returning the calendars of every page up to the call's limit.
+func (clc *CalendarListCall) All(ctx context.Context) ([]*Calendar, error) {
+	return all(ctx, clc.Pages, clc.limit)
+}
+
+func (clc *CalendarListCall) request(result interface{}) *callRequest {
+	if clc.nextLink != "" {
+		return &callRequest{method: http.MethodGet, path: clc.nextLink, result: result}
+	}
+
+	params := url.Values{}
+	params.Set("$top", strconv.FormatInt(clc.maxResults, 10))
+	params.Set("$count", "true")
+	clc.query.Apply(params)
+
+	return &callRequest{method: http.MethodGet, path: clc.service.basePath, params: params, result: result}
+}
+
+func (clc *CalendarListCall) batchRequest() *callRequest {
+	return clc.request(&CalendarListResult{})
+}
+
 // CalendarGetCall struct allowing for fluent style configuration of calls to the calendar get endpoint.
 type CalendarGetCall struct {
 	service    *CalendarService
 	calendarID string
+	query      odata.Query
 }
 
 // Get returns an instance of a CalendarGetCall with the given calendarID.
@@ -78,16 +136,38 @@ func (cs *CalendarService) Get(calendarID string) *CalendarGetCall {
 	}
 }
 
+// Select sets the $select query parameter for the calendar get call, limiting the properties returned.
+func (cgc *CalendarGetCall) Select(fields ...string) *CalendarGetCall {
+	cgc.query.Select = fields
+	return cgc
+}
+
+// Expand sets the $expand query parameter for the calendar get call, including the given relationships of the calendar.
+func (cgc *CalendarGetCall) Expand(relationships ...string) *CalendarGetCall {
+	cgc.query.Expand = relationships
+	return cgc
+}
+
 // Do executes the http get request to microsoft's graph api to get the call's calendar.
 func (cgc *CalendarGetCall) Do(ctx context.Context) (*Calendar, error) {
-	path := fmt.Sprintf("%s/%s", cgc.service.basePath, cgc.calendarID)
 	calendar := Calendar{}
-	if _, err := cgc.service.session.Get(ctx, path, nil, &calendar); err != nil {
+	if _, err := cgc.request(&calendar).do(ctx, cgc.service.requester); err != nil {
 		return nil, err
 	}
 	return &calendar, nil
 }
 
+func (cgc *CalendarGetCall) request(result interface{}) *callRequest {
+	path := fmt.Sprintf("%s/%s", cgc.service.basePath, cgc.calendarID)
+	params := url.Values{}
+	cgc.query.Apply(params)
+	return &callRequest{method: http.MethodGet, path: path, params: params, result: result}
+}
+
+func (cgc *CalendarGetCall) batchRequest() *callRequest {
+	return cgc.request(&Calendar{})
+}
+
 // CalendarCreateCall struct allowing for fluent style configuration of calls to the calendar create endpoint.
 type CalendarCreateCall struct {
 	service  *CalendarService
@@ -110,17 +190,22 @@ func (ccc *CalendarCreateCall) Calendar(calendar *Calendar) *CalendarCreateCall
 
 // Do executes the http post request to microsoft's graph api to create the call's calendar.
 func (ccc *CalendarCreateCall) Do(ctx context.Context) (*Calendar, error) {
-	if _, err := ccc.service.session.Post(ctx, ccc.service.basePath, ccc.calendar, ccc.calendar); err != nil {
+	if _, err := ccc.batchRequest().do(ctx, ccc.service.requester); err != nil {
 		return nil, err
 	}
 	return ccc.calendar, nil
 }
 
+func (ccc *CalendarCreateCall) batchRequest() *callRequest {
+	return &callRequest{method: http.MethodPost, path: ccc.service.basePath, body: ccc.calendar, result: ccc.calendar}
+}
+
 // CalendarUpdateCall struct allowing for fluent style configuration of calls to the calendar update endpoint.
 type CalendarUpdateCall struct {
 	service    *CalendarService
 	calendarID string
 	calendar   *Calendar
+	etag       string
 }
 
 // Update returns an instance of a CalendarUpdateCall with the given calendarID.
@@ -138,19 +223,30 @@ func (cuc *CalendarUpdateCall) Calendar(calendar *Calendar) *CalendarUpdateCall
 	return cuc
 }
 
+// IfMatch makes the update fail with ErrPreconditionFailed if the calendar has changed since it was read with the given etag.
+func (cuc *CalendarUpdateCall) IfMatch(etag string) *CalendarUpdateCall {
+	cuc.etag = etag
+	return cuc
+}
+
 // Do executes the http patch request to microsoft's graph api to update the call's calendar.
 func (cuc *CalendarUpdateCall) Do(ctx context.Context) (*Calendar, error) {
-	path := fmt.Sprintf("%s/%s", cuc.service.basePath, cuc.calendarID)
-	if _, err := cuc.service.session.Patch(ctx, path, cuc.calendar, cuc.calendar); err != nil {
+	if _, err := cuc.batchRequest().do(ctx, cuc.service.requester); err != nil {
 		return nil, err
 	}
 	return cuc.calendar, nil
 }
 
+func (cuc *CalendarUpdateCall) batchRequest() *callRequest {
+	path := fmt.Sprintf("%s/%s", cuc.service.basePath, cuc.calendarID)
+	return &callRequest{method: http.MethodPatch, path: path, header: ifMatchHeader(cuc.etag), body: cuc.calendar, result: cuc.calendar}
+}
+
 // CalendarDeleteCall struct allowing for fluent style configuration of calls to the calendar delete endpoint.
 type CalendarDeleteCall struct {
 	service    *CalendarService
 	calendarID string
+	etag       string
 }
 
 // Delete returns an instance of a CalendarDeleteCall with the given calendarID.
@@ -161,11 +257,21 @@ func (cs *CalendarService) Delete(calendarID string) *CalendarDeleteCall {
 	}
 }
 
+// IfMatch makes the delete fail with ErrPreconditionFailed if the calendar has changed since it was read with the given etag.
+func (cdc *CalendarDeleteCall) IfMatch(etag string) *CalendarDeleteCall {
+	cdc.etag = etag
+	return cdc
+}
+
 // Do executes the http delete request to microsoft's graph api to delete the call's calendar.
 func (cdc *CalendarDeleteCall) Do(ctx context.Context) error {
-	path := fmt.Sprintf("%s/%s", cdc.service.basePath, cdc.calendarID)
-	if _, err := cdc.service.session.Delete(ctx, path, nil, nil); err != nil {
+	if _, err := cdc.batchRequest().do(ctx, cdc.service.requester); err != nil {
 		return err
 	}
 	return nil
 }
+
+func (cdc *CalendarDeleteCall) batchRequest() *callRequest {
+	path := fmt.Sprintf("%s/%s", cdc.service.basePath, cdc.calendarID)
+	return &callRequest{method: http.MethodDelete, path: path, header: ifMatchHeader(cdc.etag)}
+}
@@ -0,0 +1,186 @@
+package outlook
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Signing algorithms supported for the client assertions of certificate authenticated clients.
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmPS256 = "PS256"
+
+	clientAssertionType     = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	clientAssertionLifetime = 10 * time.Minute
+)
+
+var (
+	// ErrUnsupportedSigningAlgorithm is returned when a client certificate is configured with an algorithm other than RS256 or PS256.
+	ErrUnsupportedSigningAlgorithm = fmt.Errorf("client assertions can only be signed with RS256 or PS256")
+	// ErrNoCertificate is returned when pem data holds no certificate or no rsa private key, or when a client is configured with a nil one.
+	ErrNoCertificate = fmt.Errorf("client certificates need both a certificate and an rsa private key")
+)
+
+// clientCertificate the certificate and key a confidential client authenticates with instead of an app secret.
+type clientCertificate struct {
+	cert      *x509.Certificate
+	key       *rsa.PrivateKey
+	algorithm string
+}
+
+// SetClientCertificate returns a ClientOpt function which makes the client authenticate with a client assertion signed by the given certificate's key, using RS256 or PS256.
+// When set, the certificate takes precedence over the client's app secret.
+func SetClientCertificate(cert *x509.Certificate, key *rsa.PrivateKey, algorithm string) ClientOpt {
+	return func(c *Client) {
+		c.SetCertificate(cert, key, algorithm)
+	}
+}
+
+// SetCertificate fluent configuration of the certificate the client authenticates with.
+// Token requests fail with ErrNoCertificate if either cert or key is nil.
+func (client *Client) SetCertificate(cert *x509.Certificate, key *rsa.PrivateKey, algorithm string) *Client {
+	if algorithm == "" {
+		algorithm = SigningAlgorithmRS256
+	}
+	client.certificate = &clientCertificate{
+		cert:      cert,
+		key:       key,
+		algorithm: algorithm,
+	}
+	return client
+}
+
+// ParseCertificatePEM returns the first certificate and rsa private key, in either PKCS#1 or PKCS#8 form, found in the given pem data.
+func ParseCertificatePEM(data []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert != nil {
+				continue
+			}
+			parsed, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			cert = parsed
+		case "RSA PRIVATE KEY":
+			parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = parsed
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, ErrNoCertificate
+			}
+			key = rsaKey
+		}
+	}
+	if cert == nil || key == nil {
+		return nil, nil, ErrNoCertificate
+	}
+	return cert, key, nil
+}
+
+// authenticate adds the client's credentials for the given token endpoint to a token request, preferring its certificate over its app secret.
+func (client *Client) authenticate(body url.Values, tokenURL string) error {
+	if client.certificate != nil {
+		assertion, err := client.certificate.assertion(client.appID, tokenURL)
+		if err != nil {
+			return err
+		}
+		body.Set("client_assertion_type", clientAssertionType)
+		body.Set("client_assertion", assertion)
+		return nil
+	}
+	if client.appSecret != "" {
+		body.Set("client_secret", client.appSecret)
+	}
+	return nil
+}
+
+// assertion builds and signs the client assertion jwt identifying the app to the given token endpoint.
+func (cc *clientCertificate) assertion(appID, audience string) (string, error) {
+	if cc.cert == nil || cc.key == nil {
+		return "", ErrNoCertificate
+	}
+	header := map[string]string{
+		"alg": cc.algorithm,
+		"typ": "JWT",
+	}
+	switch cc.algorithm {
+	case SigningAlgorithmRS256:
+		thumbprint := sha1.Sum(cc.cert.Raw)
+		header["x5t"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	case SigningAlgorithmPS256:
+		thumbprint := sha256.Sum256(cc.cert.Raw)
+		header["x5t#S256"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	default:
+		return "", ErrUnsupportedSigningAlgorithm
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": appID,
+		"sub": appID,
+		"jti": hex.EncodeToString(jti),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(clientAssertionLifetime).Unix(),
+	}
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := fmt.Sprintf(
+		"%s.%s",
+		base64.RawURLEncoding.EncodeToString(encodedHeader),
+		base64.RawURLEncoding.EncodeToString(encodedClaims),
+	)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	if cc.algorithm == SigningAlgorithmPS256 {
+		signature, err = rsa.SignPSS(rand.Reader, cc.key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	} else {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, cc.key, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s.%s", signingInput, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
@@ -0,0 +1,197 @@
+package outlook
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a throwaway self-signed certificate and the rsa key it was issued for.
+func testCertificate(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "go-outlook test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// decodeSegment decodes the base64url encoded json segment of a jwt into v.
+func decodeSegment(t *testing.T, segment string, v interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseCertificatePEM(t *testing.T) {
+	cert, key := testCertificate(t)
+	certBlock := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"pkcs1", append(certBlock, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})...), nil},
+		{"pkcs8 before the certificate", append(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), certBlock...), nil},
+		{"no key", certBlock, ErrNoCertificate},
+		{"no certificate", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), ErrNoCertificate},
+		{"ecdsa key", append(certBlock, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecPKCS8})...), ErrNoCertificate},
+		{"not pem", []byte("not pem"), ErrNoCertificate},
+	}
+	for _, tt := range tests {
+		gotCert, gotKey, err := ParseCertificatePEM(tt.data)
+		if err != tt.wantErr {
+			t.Errorf("%s: ParseCertificatePEM() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && (!gotCert.Equal(cert) || !gotKey.Equal(key)) {
+			t.Errorf("%s: ParseCertificatePEM() returned another certificate or key", tt.name)
+		}
+	}
+}
+
+func TestClientCertificateAssertion(t *testing.T) {
+	cert, key := testCertificate(t)
+	const audience = "https://login.microsoftonline.com/contoso/oauth2/v2.0/token"
+
+	for _, algorithm := range []string{SigningAlgorithmRS256, SigningAlgorithmPS256} {
+		cc := &clientCertificate{cert: cert, key: key, algorithm: algorithm}
+		before := time.Now().Unix()
+		assertion, err := cc.assertion("app", audience)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		parts := strings.Split(assertion, ".")
+		if len(parts) != 3 {
+			t.Fatalf("%s: assertion %q isn't a signed jwt", algorithm, assertion)
+		}
+
+		var header map[string]string
+		decodeSegment(t, parts[0], &header)
+		sha1Thumbprint := sha1.Sum(cert.Raw)
+		sha256Thumbprint := sha256.Sum256(cert.Raw)
+		want := map[string]string{"alg": algorithm, "typ": "JWT"}
+		if algorithm == SigningAlgorithmRS256 {
+			want["x5t"] = base64.RawURLEncoding.EncodeToString(sha1Thumbprint[:])
+		} else {
+			want["x5t#S256"] = base64.RawURLEncoding.EncodeToString(sha256Thumbprint[:])
+		}
+		if len(header) != len(want) {
+			t.Errorf("%s: header %v, want %v", algorithm, header, want)
+		}
+		for k, v := range want {
+			if header[k] != v {
+				t.Errorf("%s: header %s = %q, want %q", algorithm, k, header[k], v)
+			}
+		}
+
+		var claims struct {
+			Aud string `json:"aud"`
+			Iss string `json:"iss"`
+			Sub string `json:"sub"`
+			Jti string `json:"jti"`
+			Iat int64  `json:"iat"`
+			Nbf int64  `json:"nbf"`
+			Exp int64  `json:"exp"`
+		}
+		decodeSegment(t, parts[1], &claims)
+		if claims.Aud != audience || claims.Iss != "app" || claims.Sub != "app" || claims.Jti == "" {
+			t.Errorf("%s: claims %+v", algorithm, claims)
+		}
+		if claims.Iat < before || claims.Nbf != claims.Iat || claims.Exp != claims.Iat+int64(clientAssertionLifetime.Seconds()) {
+			t.Errorf("%s: claims issued at %d, valid from %d until %d, want ten minutes from now", algorithm, claims.Iat, claims.Nbf, claims.Exp)
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		publicKey := cert.PublicKey.(*rsa.PublicKey)
+		if algorithm == SigningAlgorithmRS256 {
+			err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+		} else {
+			err = rsa.VerifyPSS(publicKey, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			t.Errorf("%s: signature doesn't verify with the certificate's key: %v", algorithm, err)
+		}
+	}
+
+	cc := &clientCertificate{cert: cert, key: key, algorithm: "HS256"}
+	if _, err := cc.assertion("app", audience); err != ErrUnsupportedSigningAlgorithm {
+		t.Errorf("HS256 assertion error = %v, want ErrUnsupportedSigningAlgorithm", err)
+	}
+}
+
+func TestClientAuthenticate(t *testing.T) {
+	cert, key := testCertificate(t)
+	client, err := NewClient(SetClientAppID("app"), SetClientAppSecret("secret"), SetClientCertificate(cert, key, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificate takes precedence over the app secret
+	body := url.Values{}
+	if err := client.authenticate(body, "https://login.microsoftonline.com/common/oauth2/v2.0/token"); err != nil {
+		t.Fatal(err)
+	}
+	if body.Get("client_assertion_type") != clientAssertionType || body.Get("client_assertion") == "" || body.Has("client_secret") {
+		t.Errorf("authenticated body %v, want a client assertion and no secret", body)
+	}
+
+	for _, client := range []*Client{
+		new(Client).SetCertificate(nil, key, SigningAlgorithmRS256),
+		new(Client).SetCertificate(cert, nil, SigningAlgorithmPS256),
+	} {
+		if err := client.authenticate(url.Values{}, "https://login.microsoftonline.com/common/oauth2/v2.0/token"); err != ErrNoCertificate {
+			t.Errorf("authenticate() with a nil certificate or key error = %v, want ErrNoCertificate", err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package outlook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cloud the pair of hosts used to authenticate against and call microsoft's graph api in one of microsoft's clouds.
+type Cloud struct {
+	AuthorityHost string
+	GraphHost     string
+}
+
+var (
+	// CloudGlobal microsoft's global cloud, used by default.
+	CloudGlobal = Cloud{
+		AuthorityHost: DefaultAuthorityHost,
+		GraphHost:     DefaultGraphHost,
+	}
+	// CloudUSGov microsoft's US Government L4 cloud (GCC High).
+	CloudUSGov = Cloud{
+		AuthorityHost: "https://login.microsoftonline.us",
+		GraphHost:     "https://graph.microsoft.us",
+	}
+	// CloudUSGovDoD microsoft's US Government L5 cloud (DoD).
+	CloudUSGovDoD = Cloud{
+		AuthorityHost: "https://login.microsoftonline.us",
+		GraphHost:     "https://dod-graph.microsoft.us",
+	}
+	// CloudChina microsoft's China cloud operated by 21Vianet.
+	CloudChina = Cloud{
+		AuthorityHost: "https://login.chinacloudapi.cn",
+		GraphHost:     "https://microsoftgraph.chinacloudapi.cn",
+	}
+)
+
+// SetClientTenant returns a ClientOpt function which sets the tenant the client authenticates against. Defaults to common, which is also used if tenantID is empty.
+func SetClientTenant(tenantID string) ClientOpt {
+	return func(c *Client) {
+		c.tenantID = tenantOrDefault(tenantID)
+	}
+}
+
+// SetClientAuthorityHost returns a ClientOpt function which sets the host of microsoft's identity platform. A scheme of https is assumed if none is given.
+func SetClientAuthorityHost(host string) ClientOpt {
+	return func(c *Client) {
+		c.authorityHost = normalizeHost(host)
+	}
+}
+
+// SetClientGraphHost returns a ClientOpt function which sets the host of microsoft's graph api. A scheme of https is assumed if none is given.
+func SetClientGraphHost(host string) ClientOpt {
+	return func(c *Client) {
+		c.graphHost = normalizeHost(host)
+	}
+}
+
+// SetClientCloud returns a ClientOpt function which points the client at both hosts of the given cloud, e.g. CloudUSGov or CloudChina.
+func SetClientCloud(cloud Cloud) ClientOpt {
+	return func(c *Client) {
+		c.authorityHost = normalizeHost(cloud.AuthorityHost)
+		c.graphHost = normalizeHost(cloud.GraphHost)
+	}
+}
+
+// SetTenant fluent configuration of the tenant the client authenticates against. An empty tenantID resets it to common.
+func (client *Client) SetTenant(tenantID string) *Client {
+	client.tenantID = tenantOrDefault(tenantID)
+	return client
+}
+
+// authorityURL returns the url of the given oauth2 endpoint (authorize, token or devicecode) for the tenant, falling back to the client's tenant.
+func (client *Client) authorityURL(tenantID, endpoint string) string {
+	if tenantID == "" {
+		tenantID = client.tenantID
+	}
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/%s", client.authorityHost, tenantOrDefault(tenantID), endpoint)
+}
+
+// tenantOrDefault returns tenantID, or DefaultTenant if it is empty, so that authority urls never hold an empty path segment.
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return DefaultTenant
+	}
+	return tenantID
+}
+
+// appScope returns the scope requested by app-only grants, which is whatever application permissions the app has been consented on the graph host.
+func (client *Client) appScope() string {
+	return fmt.Sprintf("%s/.default", client.graphHost)
+}
+
+// isMultiTenant reports whether the tenant is one of the aliases which don't identify a single tenant.
+func isMultiTenant(tenantID string) bool {
+	switch strings.ToLower(tenantID) {
+	case "common", "organizations", "consumers":
+		return true
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	host = strings.TrimRight(host, "/")
+	if !strings.Contains(host, "://") {
+		host = fmt.Sprintf("https://%s", host)
+	}
+	return host
+}
@@ -0,0 +1,109 @@
+package outlook
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientAuthorityAndGraphURLs(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []ClientOpt
+		tokenURL  string
+		baseURL   string
+		appScope  string
+		authorize string
+	}{
+		{
+			name:      "defaults",
+			tokenURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+			baseURL:   "https://graph.microsoft.com/v1.0",
+			appScope:  "https://graph.microsoft.com/.default",
+			authorize: "https://login.microsoftonline.com/common/oauth2/v2.0/authorize?",
+		},
+		{
+			name:      "tenant",
+			opts:      []ClientOpt{SetClientTenant("contoso.onmicrosoft.com")},
+			tokenURL:  "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/token",
+			baseURL:   "https://graph.microsoft.com/v1.0",
+			appScope:  "https://graph.microsoft.com/.default",
+			authorize: "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/authorize?",
+		},
+		{
+			name:     "empty tenant",
+			opts:     []ClientOpt{SetClientTenant("contoso.onmicrosoft.com"), SetClientTenant("")},
+			tokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+			baseURL:  "https://graph.microsoft.com/v1.0",
+			appScope: "https://graph.microsoft.com/.default",
+		},
+		{
+			name:      "us government",
+			opts:      []ClientOpt{SetClientCloud(CloudUSGov), SetClientTenant("contoso.onmicrosoft.us")},
+			tokenURL:  "https://login.microsoftonline.us/contoso.onmicrosoft.us/oauth2/v2.0/token",
+			baseURL:   "https://graph.microsoft.us/v1.0",
+			appScope:  "https://graph.microsoft.us/.default",
+			authorize: "https://login.microsoftonline.us/contoso.onmicrosoft.us/oauth2/v2.0/authorize?",
+		},
+		{
+			name:     "us government dod",
+			opts:     []ClientOpt{SetClientCloud(CloudUSGovDoD)},
+			tokenURL: "https://login.microsoftonline.us/common/oauth2/v2.0/token",
+			baseURL:  "https://dod-graph.microsoft.us/v1.0",
+			appScope: "https://dod-graph.microsoft.us/.default",
+		},
+		{
+			name:      "china",
+			opts:      []ClientOpt{SetClientCloud(CloudChina)},
+			tokenURL:  "https://login.chinacloudapi.cn/common/oauth2/v2.0/token",
+			baseURL:   "https://microsoftgraph.chinacloudapi.cn/v1.0",
+			appScope:  "https://microsoftgraph.chinacloudapi.cn/.default",
+			authorize: "https://login.chinacloudapi.cn/common/oauth2/v2.0/authorize?",
+		},
+		{
+			name:     "hosts without a scheme",
+			opts:     []ClientOpt{SetClientAuthorityHost("login.example.com/"), SetClientGraphHost("graph.example.com")},
+			tokenURL: "https://login.example.com/common/oauth2/v2.0/token",
+			baseURL:  "https://graph.example.com/v1.0",
+			appScope: "https://graph.example.com/.default",
+		},
+		{
+			name:     "host overriding the cloud",
+			opts:     []ClientOpt{SetClientCloud(CloudChina), SetClientGraphHost("http://localhost:8080")},
+			tokenURL: "https://login.chinacloudapi.cn/common/oauth2/v2.0/token",
+			baseURL:  "http://localhost:8080/v1.0",
+			appScope: "http://localhost:8080/.default",
+		},
+	}
+	for _, tt := range tests {
+		client, err := NewClient(tt.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := client.authorityURL("", "token"); got != tt.tokenURL {
+			t.Errorf("%s: token url %s, want %s", tt.name, got, tt.tokenURL)
+		}
+		if got := client.baseURL.String(); got != tt.baseURL {
+			t.Errorf("%s: base url %s, want %s", tt.name, got, tt.baseURL)
+		}
+		if got := client.appScope(); got != tt.appScope {
+			t.Errorf("%s: app scope %s, want %s", tt.name, got, tt.appScope)
+		}
+		if got := client.AuthCodeURL(""); tt.authorize != "" && !strings.HasPrefix(got, tt.authorize) {
+			t.Errorf("%s: authorize url %s, want it to start with %s", tt.name, got, tt.authorize)
+		}
+	}
+}
+
+func TestAuthorityURLTenant(t *testing.T) {
+	client, err := NewClient(SetClientTenant("contoso.onmicrosoft.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A session's own tenant wins over the client's
+	if got := client.authorityURL("fabrikam.onmicrosoft.com", "devicecode"); got != "https://login.microsoftonline.com/fabrikam.onmicrosoft.com/oauth2/v2.0/devicecode" {
+		t.Errorf("device code url %s", got)
+	}
+	if got := client.SetTenant("").authorityURL("", "authorize"); got != "https://login.microsoftonline.com/common/oauth2/v2.0/authorize" {
+		t.Errorf("authorize url %s after resetting the tenant", got)
+	}
+}
@@ -0,0 +1,208 @@
+package outlook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables, and keys of key=value config files, read into a Config.
+const (
+	EnvAppID         = "OUTLOOK_APP_ID"
+	EnvAppSecret     = "OUTLOOK_APP_SECRET"
+	EnvRedirectURI   = "OUTLOOK_REDIRECT_URI"
+	EnvScopes        = "OUTLOOK_SCOPES"
+	EnvTenantID      = "OUTLOOK_TENANT_ID"
+	EnvCloud         = "OUTLOOK_CLOUD"
+	EnvAuthorityHost = "OUTLOOK_AUTHORITY_HOST"
+	EnvGraphHost     = "OUTLOOK_GRAPH_HOST"
+	EnvCertPath      = "OUTLOOK_CERT_PATH"
+	EnvCertAlgorithm = "OUTLOOK_CERT_ALGORITHM"
+	EnvPublicClient  = "OUTLOOK_PUBLIC_CLIENT"
+)
+
+// clouds the named clouds a Config can select with its Cloud field.
+var clouds = map[string]Cloud{
+	"global":    CloudGlobal,
+	"usgov":     CloudUSGov,
+	"usgov-dod": CloudUSGovDoD,
+	"china":     CloudChina,
+}
+
+// Config the settings used to bootstrap a Client from the environment or a config file.
+// Cloud selects one of the named clouds (global, usgov, usgov-dod or china), while AuthorityHost and GraphHost override its hosts individually.
+// CertPath points at a pem file holding both the certificate and private key the client should authenticate with instead of AppSecret.
+// PublicClient marks an app which can't keep a secret, such as a cli using the device code flow, so that neither AppSecret nor CertPath is required.
+type Config struct {
+	AppID         string `json:"appId,omitempty"`
+	AppSecret     string `json:"appSecret,omitempty"`
+	RedirectURI   string `json:"redirectUri,omitempty"`
+	Scopes        string `json:"scopes,omitempty"`
+	TenantID      string `json:"tenantId,omitempty"`
+	Cloud         string `json:"cloud,omitempty"`
+	AuthorityHost string `json:"authorityHost,omitempty"`
+	GraphHost     string `json:"graphHost,omitempty"`
+	CertPath      string `json:"certPath,omitempty"`
+	CertAlgorithm string `json:"certAlgorithm,omitempty"`
+	PublicClient  bool   `json:"publicClient,omitempty"`
+}
+
+// ConfigFromEnv returns a Config read from the OUTLOOK_* environment variables. The returned Config has not been validated.
+func ConfigFromEnv() *Config {
+	return configFromLookup(os.Getenv)
+}
+
+// LoadConfig reads and validates the Config in the file at path.
+// Files ending in .json, or whose content starts with '{', are read as json; anything else is read as KEY=value lines using the OUTLOOK_* environment variable names, where blank lines and lines starting with # are ignored.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg *Config
+	trimmed := bytes.TrimSpace(data)
+	if strings.EqualFold(filepath.Ext(path), ".json") || bytes.HasPrefix(trimmed, []byte("{")) {
+		cfg = &Config{}
+		if err := json.Unmarshal(trimmed, cfg); err != nil {
+			return nil, err
+		}
+	} else {
+		values := map[string]string{}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		cfg = configFromLookup(func(key string) string { return values[key] })
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func configFromLookup(lookup func(string) string) *Config {
+	return &Config{
+		AppID:         lookup(EnvAppID),
+		AppSecret:     lookup(EnvAppSecret),
+		RedirectURI:   lookup(EnvRedirectURI),
+		Scopes:        lookup(EnvScopes),
+		TenantID:      lookup(EnvTenantID),
+		Cloud:         lookup(EnvCloud),
+		AuthorityHost: lookup(EnvAuthorityHost),
+		GraphHost:     lookup(EnvGraphHost),
+		CertPath:      lookup(EnvCertPath),
+		CertAlgorithm: lookup(EnvCertAlgorithm),
+		PublicClient:  strings.EqualFold(lookup(EnvPublicClient), "true"),
+	}
+}
+
+// Validate checks that the fields required to build a Client are present and that the ones given are usable, returning an *ErrInvalidConfig listing every problem found.
+func (cfg *Config) Validate() error {
+	configErr := &ErrInvalidConfig{}
+	if cfg.AppID == "" {
+		configErr.Missing = append(configErr.Missing, "app id ("+EnvAppID+")")
+	}
+	// Only confidential clients authenticate themselves; public clients such as those using the device code flow hold no credentials
+	if !cfg.PublicClient && cfg.AppSecret == "" && cfg.CertPath == "" {
+		configErr.Missing = append(configErr.Missing, "app secret ("+EnvAppSecret+") or certificate ("+EnvCertPath+")")
+	}
+	switch cfg.CertAlgorithm {
+	case "", SigningAlgorithmRS256, SigningAlgorithmPS256:
+	default:
+		configErr.Invalid = append(configErr.Invalid, "certificate algorithm ("+EnvCertAlgorithm+")")
+	}
+	if _, ok := clouds[strings.ToLower(cfg.Cloud)]; cfg.Cloud != "" && !ok {
+		configErr.Invalid = append(configErr.Invalid, "cloud ("+EnvCloud+")")
+	}
+	if cfg.RedirectURI != "" && !isAbsoluteURL(cfg.RedirectURI) {
+		configErr.Invalid = append(configErr.Invalid, "redirect uri ("+EnvRedirectURI+")")
+	}
+	if cfg.AuthorityHost != "" && !isAbsoluteURL(normalizeHost(cfg.AuthorityHost)) {
+		configErr.Invalid = append(configErr.Invalid, "authority host ("+EnvAuthorityHost+")")
+	}
+	if cfg.GraphHost != "" && !isAbsoluteURL(normalizeHost(cfg.GraphHost)) {
+		configErr.Invalid = append(configErr.Invalid, "graph host ("+EnvGraphHost+")")
+	}
+	if len(configErr.Missing) > 0 || len(configErr.Invalid) > 0 {
+		return configErr
+	}
+	return nil
+}
+
+// ClientOpts returns the ClientOpt functions which apply the config's fields to a Client, reading the certificate from CertPath if set. Empty fields leave the client's defaults in place.
+func (cfg *Config) ClientOpts() ([]ClientOpt, error) {
+	opts := []ClientOpt{
+		SetClientAppID(cfg.AppID),
+		SetClientAppSecret(cfg.AppSecret),
+	}
+	if cfg.RedirectURI != "" {
+		opts = append(opts, SetClientRedirectURI(cfg.RedirectURI))
+	}
+	if cfg.Scopes != "" {
+		opts = append(opts, SetClientScope(cfg.Scopes))
+	}
+	if cfg.TenantID != "" {
+		opts = append(opts, SetClientTenant(cfg.TenantID))
+	}
+	if cloud, ok := clouds[strings.ToLower(cfg.Cloud)]; ok {
+		opts = append(opts, SetClientCloud(cloud))
+	}
+	if cfg.AuthorityHost != "" {
+		opts = append(opts, SetClientAuthorityHost(cfg.AuthorityHost))
+	}
+	if cfg.GraphHost != "" {
+		opts = append(opts, SetClientGraphHost(cfg.GraphHost))
+	}
+	if cfg.CertPath != "" {
+		data, err := ioutil.ReadFile(cfg.CertPath)
+		if err != nil {
+			return nil, err
+		}
+		cert, key, err := ParseCertificatePEM(data)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, SetClientCertificate(cert, key, cfg.CertAlgorithm))
+	}
+	return opts, nil
+}
+
+// NewClientFromConfig validates the config and returns a new instance of a Client built from it. Any extra opts are applied after the config's.
+func NewClientFromConfig(cfg *Config, opts ...ClientOpt) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfgOpts, err := cfg.ClientOpts()
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(append(cfgOpts, opts...)...)
+}
+
+// NewClientFromEnv returns a new instance of a Client configured from the OUTLOOK_* environment variables. Any extra opts are applied after the environment's.
+func NewClientFromEnv(opts ...ClientOpt) (*Client, error) {
+	return NewClientFromConfig(ConfigFromEnv(), opts...)
+}
+
+func isAbsoluteURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && parsed.Scheme != "" && parsed.Host != ""
+}
@@ -0,0 +1,171 @@
+package outlook
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig writes data to a file with the given name in a temporary directory, returning its path.
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigKeyValue(t *testing.T) {
+	path := writeConfig(t, "outlook.env", `
+# credentials for the sync worker
+OUTLOOK_APP_ID = app
+OUTLOOK_APP_SECRET="s3cr=t"
+OUTLOOK_SCOPES='mail.read offline_access'
+  # an indented comment
+OUTLOOK_TENANT_ID
+OUTLOOK_CLOUD=usgov
+OUTLOOK_PUBLIC_CLIENT=TRUE
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		AppID:        "app",
+		AppSecret:    "s3cr=t",
+		Scopes:       "mail.read offline_access",
+		Cloud:        "usgov",
+		PublicClient: true,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	for _, name := range []string{"outlook.json", "outlook.conf"} {
+		// Files without a .json extension are sniffed by their leading brace
+		path := writeConfig(t, name, `
+  {"appId": "app", "appSecret": "secret", "tenantId": "contoso.onmicrosoft.com", "graphHost": "graph.example.com"}`)
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := &Config{AppID: "app", AppSecret: "secret", TenantID: "contoso.onmicrosoft.com", GraphHost: "graph.example.com"}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: LoadConfig() = %+v, want %+v", name, cfg, want)
+		}
+	}
+
+	if _, err := LoadConfig(writeConfig(t, "outlook.json", "OUTLOOK_APP_ID=app")); err == nil {
+		t.Error("LoadConfig() read key=value lines from a .json file")
+	}
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadConfig() of a missing file succeeded")
+	}
+	var configErr *ErrInvalidConfig
+	if _, err := LoadConfig(writeConfig(t, "outlook.json", `{"appSecret":"secret"}`)); !errors.As(err, &configErr) {
+		t.Errorf("LoadConfig() of an incomplete file error = %v, want an *ErrInvalidConfig", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		missing []string
+		invalid []string
+	}{
+		{
+			name: "confidential",
+			cfg:  &Config{AppID: "app", AppSecret: "secret"},
+		},
+		{
+			name: "certificate",
+			cfg:  &Config{AppID: "app", CertPath: "cert.pem", CertAlgorithm: SigningAlgorithmPS256},
+		},
+		{
+			name: "public",
+			cfg:  &Config{AppID: "app", PublicClient: true},
+		},
+		{
+			name:    "empty",
+			cfg:     &Config{},
+			missing: []string{"app id (OUTLOOK_APP_ID)", "app secret (OUTLOOK_APP_SECRET) or certificate (OUTLOOK_CERT_PATH)"},
+		},
+		{
+			name:    "public without app id",
+			cfg:     &Config{PublicClient: true},
+			missing: []string{"app id (OUTLOOK_APP_ID)"},
+		},
+		{
+			name: "invalid fields",
+			cfg: &Config{
+				AppSecret:     "secret",
+				CertAlgorithm: "HS256",
+				Cloud:         "mars",
+				RedirectURI:   "/callback",
+				AuthorityHost: "http://%zz",
+				GraphHost:     "graph host",
+			},
+			missing: []string{"app id (OUTLOOK_APP_ID)"},
+			invalid: []string{
+				"certificate algorithm (OUTLOOK_CERT_ALGORITHM)",
+				"cloud (OUTLOOK_CLOUD)",
+				"redirect uri (OUTLOOK_REDIRECT_URI)",
+				"authority host (OUTLOOK_AUTHORITY_HOST)",
+				"graph host (OUTLOOK_GRAPH_HOST)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.missing == nil && tt.invalid == nil {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		var configErr *ErrInvalidConfig
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: Validate() = %v, want an *ErrInvalidConfig", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(configErr.Missing, tt.missing) || !reflect.DeepEqual(configErr.Invalid, tt.invalid) {
+			t.Errorf("%s: Validate() found missing %q and invalid %q, want %q and %q", tt.name, configErr.Missing, configErr.Invalid, tt.missing, tt.invalid)
+		}
+	}
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	for _, key := range []string{EnvAppID, EnvAppSecret, EnvRedirectURI, EnvScopes, EnvTenantID, EnvCloud, EnvAuthorityHost, EnvGraphHost, EnvCertPath, EnvCertAlgorithm, EnvPublicClient} {
+		t.Setenv(key, "")
+	}
+	var configErr *ErrInvalidConfig
+	if _, err := NewClientFromEnv(); !errors.As(err, &configErr) {
+		t.Errorf("NewClientFromEnv() without an environment error = %v, want an *ErrInvalidConfig", err)
+	}
+
+	t.Setenv(EnvAppID, "app")
+	t.Setenv(EnvAppSecret, "secret")
+	t.Setenv(EnvTenantID, "contoso.onmicrosoft.com")
+	t.Setenv(EnvCloud, "China")
+	t.Setenv(EnvGraphHost, "graph.example.com")
+	client, err := NewClientFromEnv(SetClientScope("mail.read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.appID != "app" || client.appSecret != "secret" || client.scope != "mail.read" {
+		t.Errorf("client has app id %q, secret %q and scope %q", client.appID, client.appSecret, client.scope)
+	}
+	// The graph host overrides the cloud's, while its authority host is kept
+	if got := client.authorityURL("", "token"); got != "https://login.chinacloudapi.cn/contoso.onmicrosoft.com/oauth2/v2.0/token" {
+		t.Errorf("token url %s", got)
+	}
+	if got := client.baseURL.String(); got != "https://graph.example.com/v1.0" {
+		t.Errorf("base url %s", got)
+	}
+}
@@ -1,26 +1,161 @@
 package outlook
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 )
 
 var (
 	// ErrNoAccessToken is returned when a query is executed in a session which was either not given a refreshToken or that failed to retrieve and the access token.
 	ErrNoAccessToken = fmt.Errorf("no access token for session")
+	// ErrNoTenantID is returned when an app-only session is requested without a specific tenant the app should authenticate against.
+	ErrNoTenantID = fmt.Errorf("a tenant id is required for app-only sessions")
+	// ErrDeviceCodeExpired is returned when the user does not complete a device login before its device code expires.
+	ErrDeviceCodeExpired = fmt.Errorf("device code expired before the user completed the login")
+	// ErrInvalidNextLink is returned when a call is given a next link which doesn't point at the client's graph api, so that the session's token is never sent elsewhere.
+	ErrInvalidNextLink = fmt.Errorf("next link does not point at the client's graph api")
+
+	// errStopPaging is returned by a page callback to stop paging early without failing.
+	errStopPaging = fmt.Errorf("stop paging")
+)
+
+// Sentinels matched by an *ErrStatusCode with errors.Is, based on its status code and graph error code.
+var (
+	// ErrBadRequest matches failures with a 400 status.
+	ErrBadRequest = fmt.Errorf("bad request")
+	// ErrUnauthorized matches failures with a 401 status, which usually mean the access token is missing, expired or revoked.
+	ErrUnauthorized = fmt.Errorf("unauthorized")
+	// ErrForbidden matches failures with a 403 status.
+	ErrForbidden = fmt.Errorf("forbidden")
+	// ErrNotFound matches failures with a 404 status or an ErrorItemNotFound code.
+	ErrNotFound = fmt.Errorf("not found")
+	// ErrConflict matches failures with a 409 status.
+	ErrConflict = fmt.Errorf("conflict")
+	// ErrPreconditionFailed matches failures with a 412 status, returned when an If-Match etag no longer matches because the item was changed by someone else.
+	// The item should be fetched again and the changes merged before retrying.
+	ErrPreconditionFailed = fmt.Errorf("precondition failed")
+	// ErrThrottled matches failures with a 429 status.
+	ErrThrottled = fmt.Errorf("throttled")
+	// ErrServiceUnavailable matches failures with a 503 or 504 status.
+	ErrServiceUnavailable = fmt.Errorf("service unavailable")
+	// ErrMailboxNotEnabled matches failures for mailboxes which are inactive, soft-deleted or hosted on-premise, and so can't be reached through graph.
+	ErrMailboxNotEnabled = fmt.Errorf("mailbox not enabled for rest api")
 )
 
 // ErrStatusCode an error thrown when a given http call responds with a bad http status
+// When the response carried graph's error envelope, or an oauth error from the token endpoint, its fields are decoded into ErrorCode, Message and InnerError.
+// Otherwise Message holds the raw response body, which is always available in Body.
 type ErrStatusCode struct {
 	Code                   int
+	ErrorCode              string
 	Message                string
+	RequestID              string
+	ClientRequestID        string
+	Diagnostic             string
+	Date                   string
+	InnerError             *GraphInnerError
+	Body                   string
 	SuggestedRetryDuration time.Duration
 }
 
 func (sce *ErrStatusCode) Error() string {
+	reason := sce.Message
+	if sce.ErrorCode != "" {
+		reason = fmt.Sprintf("%s: %s", sce.ErrorCode, sce.Message)
+	}
 	return fmt.Sprintf(
 		"Call to microsoft's graph api failed with a status code: %d. Reason: %s",
 		sce.Code,
-		sce.Message,
+		reason,
 	)
 }
+
+// Is reports whether the error matches one of the status sentinels, such as ErrNotFound or ErrThrottled.
+func (sce *ErrStatusCode) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return sce.Code == http.StatusBadRequest
+	case ErrUnauthorized:
+		return sce.Code == http.StatusUnauthorized
+	case ErrForbidden:
+		return sce.Code == http.StatusForbidden
+	case ErrNotFound:
+		return sce.Code == http.StatusNotFound || sce.ErrorCode == "ErrorItemNotFound"
+	case ErrConflict:
+		return sce.Code == http.StatusConflict
+	case ErrPreconditionFailed:
+		return sce.Code == http.StatusPreconditionFailed
+	case ErrThrottled:
+		return sce.Code == http.StatusTooManyRequests
+	case ErrServiceUnavailable:
+		return sce.Code == http.StatusServiceUnavailable || sce.Code == http.StatusGatewayTimeout
+	case ErrMailboxNotEnabled:
+		return sce.ErrorCode == "MailboxNotEnabledForRESTAPI" || sce.ErrorCode == "MailboxNotSupportedForRESTAPI"
+	}
+	return false
+}
+
+// newErrStatusCode builds the error for a failed response from its status, headers and body.
+func newErrStatusCode(status int, header http.Header, body []byte) *ErrStatusCode {
+	statusErr := &ErrStatusCode{
+		Code:    status,
+		Body:    string(body),
+		Message: string(body),
+	}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if len(body) > 0 && json.Unmarshal(body, &envelope) == nil && len(envelope.Error) > 0 {
+		var graphErr GraphError
+		var tokenErr TokenErrorResponse
+		if json.Unmarshal(envelope.Error, &graphErr) == nil {
+			statusErr.ErrorCode = graphErr.Code
+			statusErr.Message = graphErr.Message
+			statusErr.InnerError = graphErr.InnerError
+			if graphErr.InnerError != nil {
+				statusErr.RequestID = graphErr.InnerError.RequestID
+				statusErr.Date = graphErr.InnerError.Date
+			}
+		} else if json.Unmarshal(body, &tokenErr) == nil {
+			statusErr.ErrorCode = tokenErr.Error
+			statusErr.Message = tokenErr.ErrorDescription
+			statusErr.RequestID = tokenErr.TraceID
+		}
+	}
+	if statusErr.RequestID == "" {
+		statusErr.RequestID = header.Get(HeaderRequestID)
+	}
+	statusErr.ClientRequestID = header.Get(HeaderClientRequestID)
+	statusErr.Diagnostic = header.Get(HeaderDiagnostic)
+	if statusErr.Date == "" {
+		statusErr.Date = header.Get("Date")
+	}
+
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		statusErr.SuggestedRetryDuration = parseRetryAfter(header.Get("Retry-After"))
+	}
+
+	return statusErr
+}
+
+// ErrInvalidConfig an error returned when a Config is missing fields required to build a Client, or has fields which can't be used.
+type ErrInvalidConfig struct {
+	Missing []string
+	Invalid []string
+}
+
+func (ice *ErrInvalidConfig) Error() string {
+	var problems []string
+	if len(ice.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing %s", strings.Join(ice.Missing, ", ")))
+	}
+	if len(ice.Invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("invalid %s", strings.Join(ice.Invalid, ", ")))
+	}
+	return fmt.Sprintf("outlook client config is incomplete: %s", strings.Join(problems, "; "))
+}
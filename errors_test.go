@@ -0,0 +1,191 @@
+package outlook
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allSentinels every sentinel an *ErrStatusCode can match with errors.Is.
+var allSentinels = []error{
+	ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict,
+	ErrPreconditionFailed, ErrThrottled, ErrServiceUnavailable, ErrMailboxNotEnabled,
+}
+
+func TestErrStatusCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		body      string
+		errorCode string
+		message   string
+		requestID string
+		date      string
+		retry     time.Duration
+		is        []error
+	}{
+		{
+			name:      "graph envelope",
+			status:    http.StatusNotFound,
+			header:    http.Header{http.CanonicalHeaderKey(HeaderRequestID): {"header-request"}, "Date": {"Mon, 05 Feb 2024 10:00:00 GMT"}},
+			body:      `{"error":{"code":"ErrorItemNotFound","message":"The specified object was not found in the store.","innerError":{"date":"2024-02-05T10:00:00","request-id":"body-request"}}}`,
+			errorCode: "ErrorItemNotFound",
+			message:   "The specified object was not found in the store.",
+			requestID: "body-request",
+			date:      "2024-02-05T10:00:00",
+			is:        []error{ErrNotFound},
+		},
+		{
+			name:      "not found by code",
+			status:    http.StatusBadRequest,
+			body:      `{"error":{"code":"ErrorItemNotFound","message":"gone"}}`,
+			errorCode: "ErrorItemNotFound",
+			message:   "gone",
+			is:        []error{ErrBadRequest, ErrNotFound},
+		},
+		{
+			name:      "ids from headers",
+			status:    http.StatusConflict,
+			header:    http.Header{http.CanonicalHeaderKey(HeaderRequestID): {"header-request"}, "Date": {"Mon, 05 Feb 2024 10:00:00 GMT"}},
+			body:      `{"error":{"code":"ErrorConflict","message":"conflict"}}`,
+			errorCode: "ErrorConflict",
+			message:   "conflict",
+			requestID: "header-request",
+			date:      "Mon, 05 Feb 2024 10:00:00 GMT",
+			is:        []error{ErrConflict},
+		},
+		{
+			name:      "oauth error",
+			status:    http.StatusBadRequest,
+			body:      `{"error":"invalid_grant","error_description":"AADSTS70008: The refresh token has expired.","trace_id":"trace"}`,
+			errorCode: "invalid_grant",
+			message:   "AADSTS70008: The refresh token has expired.",
+			requestID: "trace",
+			is:        []error{ErrBadRequest},
+		},
+		{
+			name:    "not json",
+			status:  http.StatusForbidden,
+			body:    "<html>denied</html>",
+			message: "<html>denied</html>",
+			is:      []error{ErrForbidden},
+		},
+		{
+			name:      "mailbox not enabled",
+			status:    http.StatusNotFound,
+			body:      `{"error":{"code":"MailboxNotEnabledForRESTAPI","message":"REST API is not yet supported for this mailbox."}}`,
+			errorCode: "MailboxNotEnabledForRESTAPI",
+			message:   "REST API is not yet supported for this mailbox.",
+			is:        []error{ErrNotFound, ErrMailboxNotEnabled},
+		},
+		{
+			name:      "mailbox not supported",
+			status:    http.StatusBadRequest,
+			body:      `{"error":{"code":"MailboxNotSupportedForRESTAPI","message":"on-premise"}}`,
+			errorCode: "MailboxNotSupportedForRESTAPI",
+			message:   "on-premise",
+			is:        []error{ErrBadRequest, ErrMailboxNotEnabled},
+		},
+		{
+			name:      "throttled",
+			status:    http.StatusTooManyRequests,
+			header:    http.Header{"Retry-After": {"7"}},
+			body:      `{"error":{"code":"ApplicationThrottled","message":"slow down"}}`,
+			errorCode: "ApplicationThrottled",
+			message:   "slow down",
+			retry:     7 * time.Second,
+			is:        []error{ErrThrottled},
+		},
+		{
+			name:      "unavailable",
+			status:    http.StatusServiceUnavailable,
+			header:    http.Header{"Retry-After": {"3"}},
+			body:      `{"error":{"code":"ServiceUnavailable","message":"try later"}}`,
+			errorCode: "ServiceUnavailable",
+			message:   "try later",
+			retry:     3 * time.Second,
+			is:        []error{ErrServiceUnavailable},
+		},
+		{
+			name:   "gateway timeout",
+			status: http.StatusGatewayTimeout,
+			is:     []error{ErrServiceUnavailable},
+		},
+		{
+			name:      "unauthorized",
+			status:    http.StatusUnauthorized,
+			body:      `{"error":{"code":"InvalidAuthenticationToken","message":"Access token has expired."}}`,
+			errorCode: "InvalidAuthenticationToken",
+			message:   "Access token has expired.",
+			is:        []error{ErrUnauthorized},
+		},
+		{
+			name:      "precondition failed",
+			status:    http.StatusPreconditionFailed,
+			body:      `{"error":{"code":"ErrorIrresolvableConflict","message":"changed"}}`,
+			errorCode: "ErrorIrresolvableConflict",
+			message:   "changed",
+			is:        []error{ErrPreconditionFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		header := tt.header
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set(HeaderClientRequestID, "client-request")
+		res := &http.Response{StatusCode: tt.status, Header: header, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+		// Errors reach callers wrapped, so they are matched through a wrapper
+		err := fmt.Errorf("listing: %w", checkResponse(res))
+
+		var statusErr *ErrStatusCode
+		if !errors.As(err, &statusErr) {
+			t.Errorf("%s: errors.As(%v) found no *ErrStatusCode", tt.name, err)
+			continue
+		}
+		if statusErr.Code != tt.status || statusErr.ErrorCode != tt.errorCode || statusErr.Message != tt.message || statusErr.Body != tt.body {
+			t.Errorf("%s: decoded status %d, code %q, message %q and body %q", tt.name, statusErr.Code, statusErr.ErrorCode, statusErr.Message, statusErr.Body)
+		}
+		if statusErr.RequestID != tt.requestID || statusErr.Date != tt.date || statusErr.ClientRequestID != "client-request" {
+			t.Errorf("%s: decoded request id %q, date %q and client request id %q", tt.name, statusErr.RequestID, statusErr.Date, statusErr.ClientRequestID)
+		}
+		if statusErr.SuggestedRetryDuration != tt.retry {
+			t.Errorf("%s: suggested retry %v, want %v", tt.name, statusErr.SuggestedRetryDuration, tt.retry)
+		}
+
+		for _, sentinel := range allSentinels {
+			want := false
+			for _, is := range tt.is {
+				want = want || is == sentinel
+			}
+			if got := errors.Is(err, sentinel); got != want {
+				t.Errorf("%s: errors.Is(err, %q) = %v, want %v", tt.name, sentinel, got, want)
+			}
+		}
+	}
+}
+
+func TestErrStatusCodeInnerErrorChain(t *testing.T) {
+	body := `{"error":{"code":"ErrorInvalidRequest","message":"outer","innerError":{"code":"InvalidRecipients","message":"middle","request-id":"request","client-request-id":"client","innerError":{"code":"InvalidAddress","message":"inner"}}}}`
+	err := newErrStatusCode(http.StatusBadRequest, http.Header{}, []byte(body))
+
+	var codes []string
+	for inner := err.InnerError; inner != nil; inner = inner.InnerError {
+		codes = append(codes, inner.Code+":"+inner.Message)
+	}
+	if got := strings.Join(codes, ","); got != "InvalidRecipients:middle,InvalidAddress:inner" {
+		t.Errorf("inner errors %s, want both nested levels", got)
+	}
+	if err.RequestID != "request" || err.InnerError.ClientRequestID != "client" {
+		t.Errorf("request ids %q and %q, want those of the inner error", err.RequestID, err.InnerError.ClientRequestID)
+	}
+	if want := "Call to microsoft's graph api failed with a status code: 400. Reason: ErrorInvalidRequest: outer"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
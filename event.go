@@ -3,8 +3,13 @@ package outlook
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/amhester/go-outlook/odata"
 )
 
 var (
@@ -34,15 +39,15 @@ var (
 
 // EventService manages communication with microsofts graph for event resources.
 type EventService struct {
-	session  *Session
-	basePath string
+	requester Requester
+	basePath  string
 }
 
 // NewEventService returns a new instance of a EventService.
-func NewEventService(session *Session) *EventService {
+func NewEventService(requester Requester) *EventService {
 	return &EventService{
-		session:  session,
-		basePath: "/events",
+		requester: requester,
+		basePath:  "/events",
 	}
 }
 
@@ -52,6 +57,8 @@ type EventListCall struct {
 	calendarID string
 	nextLink   string
 	maxResults int64
+	limit      int
+	query      odata.Query
 	startTime  time.Time
 	endTime    time.Time
 }
@@ -71,7 +78,7 @@ func (elc *EventListCall) MaxResults(pageSize int64) *EventListCall {
 	return elc
 }
 
-// NextLink uses the link provided to set the $skip query parameter for the event list call.
+// NextLink sets the link of the page to fetch, as returned in the NextLink of a previous result, which is followed verbatim.
 func (elc *EventListCall) NextLink(link string) *EventListCall {
 	elc.nextLink = link
 	return elc
@@ -89,18 +96,71 @@ func (elc *EventListCall) EndTime(end time.Time) *EventListCall {
 	return elc
 }
 
+// Filter sets the $filter query parameter for the event list call, e.g. odata.Field("showAs").Eq(EventShowAsBusy).
+func (elc *EventListCall) Filter(filter odata.Expr) *EventListCall {
+	elc.query.Filter = filter
+	return elc
+}
+
+// OrderBy sets the $orderby query parameter for the event list call, e.g. odata.Field("start/dateTime").Asc().
+func (elc *EventListCall) OrderBy(orders ...odata.Order) *EventListCall {
+	elc.query.OrderBy = orders
+	return elc
+}
+
+// Select sets the $select query parameter for the event list call, limiting the properties returned for each event.
+func (elc *EventListCall) Select(fields ...string) *EventListCall {
+	elc.query.Select = fields
+	return elc
+}
+
+// Expand sets the $expand query parameter for the event list call, including the given relationships of each event.
+func (elc *EventListCall) Expand(relationships ...string) *EventListCall {
+	elc.query.Expand = relationships
+	return elc
+}
+
 // Do executes the event list call, returning the event list result.
 func (elc *EventListCall) Do(ctx context.Context) (*EventListResult, error) {
-	params := map[string]interface{}{
-		"$top":          elc.maxResults,
-		"$count":        true,
-		"startDateTime": elc.startTime.Format(DefaultQueryDateTimeFormat),
-		"endDateTime":   elc.endTime.Format(DefaultQueryDateTimeFormat),
-		"$select":       DefaultEventFields,
+	var result EventListResult
+	if _, err := elc.request(&result).do(ctx, elc.service.requester); err != nil {
+		return nil, err
 	}
+
+	return &result, nil
+}
+
+// Limit caps the number of events All collects. Zero, the default, collects every event.
+func (elc *EventListCall) Limit(limit int) *EventListCall {
+	elc.limit = limit
+	return elc
+}
+
+// Pages executes the event list call and follows every next link, calling fn with each page of results until there are none left or fn returns an error.
+func (elc *EventListCall) Pages(ctx context.Context, fn func(*EventListResult) error) error {
+	call := *elc
+	return pages(ctx, call.Do, func(nextLink string) { call.nextLink = nextLink }, fn)
+}
+
+// All executes the event list call and follows every next link, returning the events of every page up to the call's limit.
+func (elc *EventListCall) All(ctx context.Context) ([]*Event, error) {
+	return all(ctx, elc.Pages, elc.limit)
+}
+
+func (elc *EventListCall) request(result interface{}) *callRequest {
 	if elc.nextLink != "" {
-		params["$skip"] = parsePageLink(elc.nextLink, "$skip")
+		return &callRequest{method: http.MethodGet, path: elc.nextLink, result: result}
+	}
+
+	params := url.Values{}
+	params.Set("$top", strconv.FormatInt(elc.maxResults, 10))
+	params.Set("$count", "true")
+	params.Set("startDateTime", elc.startTime.Format(DefaultQueryDateTimeFormat))
+	params.Set("endDateTime", elc.endTime.Format(DefaultQueryDateTimeFormat))
+	if len(elc.query.Select) == 0 {
+		params.Set("$select", DefaultEventFields)
 	}
+	elc.query.Apply(params)
 
 	var path string
 	if elc.calendarID == "primary" {
@@ -109,12 +169,11 @@ func (elc *EventListCall) Do(ctx context.Context) (*EventListResult, error) {
 		path = fmt.Sprintf("/calendars/%s%s", elc.calendarID, "/calendarView")
 	}
 
-	var result EventListResult
-	if _, err := elc.service.session.Get(ctx, path, params, &result); err != nil {
-		return nil, err
-	}
+	return &callRequest{method: http.MethodGet, path: path, params: params, result: result}
+}
 
-	return &result, nil
+func (elc *EventListCall) batchRequest() *callRequest {
+	return elc.request(&EventListResult{})
 }
 
 // EventGetCall struct allowing for fluent style configuration of calls to the event get endpoint.
@@ -122,6 +181,7 @@ type EventGetCall struct {
 	service    *EventService
 	calendarID string
 	eventID    string
+	query      odata.Query
 }
 
 // Get returns an instance of an EventGetCall with the given calendarID and eventID.
@@ -133,21 +193,38 @@ func (es *EventService) Get(calendarID string, eventID string) *EventGetCall {
 	}
 }
 
+// Select sets the $select query parameter for the event get call, limiting the properties returned.
+func (egc *EventGetCall) Select(fields ...string) *EventGetCall {
+	egc.query.Select = fields
+	return egc
+}
+
+// Expand sets the $expand query parameter for the event get call, including the given relationships of the event.
+func (egc *EventGetCall) Expand(relationships ...string) *EventGetCall {
+	egc.query.Expand = relationships
+	return egc
+}
+
 // Do executes the http get to microsoft's graph api to get the call's event.
 func (egc *EventGetCall) Do(ctx context.Context) (*Event, error) {
-	var path string
-	if egc.calendarID == "primary" {
-		path = fmt.Sprintf("/events/%s", egc.eventID)
-	} else {
-		path = fmt.Sprintf("/calendars/%s%s/%s", egc.calendarID, egc.service.basePath, egc.eventID)
-	}
 	event := Event{}
-	if _, err := egc.service.session.Get(ctx, path, nil, &event); err != nil {
+	if _, err := egc.request(&event).do(ctx, egc.service.requester); err != nil {
 		return nil, err
 	}
 	return &event, nil
 }
 
+func (egc *EventGetCall) request(result interface{}) *callRequest {
+	path := egc.service.eventPath(egc.calendarID, egc.eventID)
+	params := url.Values{}
+	egc.query.Apply(params)
+	return &callRequest{method: http.MethodGet, path: path, params: params, result: result}
+}
+
+func (egc *EventGetCall) batchRequest() *callRequest {
+	return egc.request(&Event{})
+}
+
 // EventCreateCall struct allowing for fluent style configuration of calls to the event create endpoint.
 type EventCreateCall struct {
 	service    *EventService
@@ -172,18 +249,23 @@ func (ecc *EventCreateCall) Event(event *Event) *EventCreateCall {
 
 // Do executes the http post to microsoft's graph api to create the call's event.
 func (ecc *EventCreateCall) Do(ctx context.Context) (*Event, error) {
-	path := fmt.Sprintf("/calendars/%s%s", ecc.calendarID, ecc.service.basePath)
-	if _, err := ecc.service.session.Post(ctx, path, ecc.event, ecc.event); err != nil {
+	if _, err := ecc.batchRequest().do(ctx, ecc.service.requester); err != nil {
 		return nil, err
 	}
 	return ecc.event, nil
 }
 
+func (ecc *EventCreateCall) batchRequest() *callRequest {
+	path := fmt.Sprintf("/calendars/%s%s", ecc.calendarID, ecc.service.basePath)
+	return &callRequest{method: http.MethodPost, path: path, body: ecc.event, result: ecc.event}
+}
+
 // EventUpdateCall struct allowing for fluent style configuration of calls to the event update endpoint.
 type EventUpdateCall struct {
 	service    *EventService
 	calendarID string
 	event      *Event
+	etag       string
 }
 
 // Update returns an instance of an EventUpdateCall with the given calendarID.
@@ -201,25 +283,31 @@ func (euc *EventUpdateCall) Event(event *Event) *EventUpdateCall {
 	return euc
 }
 
+// IfMatch makes the update fail with ErrPreconditionFailed if the event has changed since it was read with the given etag.
+func (euc *EventUpdateCall) IfMatch(etag string) *EventUpdateCall {
+	euc.etag = etag
+	return euc
+}
+
 // Do executes the http patch to microsoft's graph api to update the call's event.
 func (euc *EventUpdateCall) Do(ctx context.Context) (*Event, error) {
-	var path string
-	if euc.calendarID == "primary" {
-		path = fmt.Sprintf("/events/%s", euc.event.ID)
-	} else {
-		path = fmt.Sprintf("/calendars/%s%s/%s", euc.calendarID, euc.service.basePath, euc.event.ID)
-	}
-	if _, err := euc.service.session.Patch(ctx, path, euc.event, euc.event); err != nil {
+	if _, err := euc.batchRequest().do(ctx, euc.service.requester); err != nil {
 		return nil, err
 	}
 	return euc.event, nil
 }
 
+func (euc *EventUpdateCall) batchRequest() *callRequest {
+	path := euc.service.eventPath(euc.calendarID, euc.event.ID)
+	return &callRequest{method: http.MethodPatch, path: path, header: ifMatchHeader(euc.etag), body: euc.event, result: euc.event}
+}
+
 // EventDeleteCall struct allowing for fluent style configuration of calls to the event delete endpoint.
 type EventDeleteCall struct {
 	service    *EventService
 	calendarID string
 	eventID    string
+	etag       string
 }
 
 // Delete returns an instance of an EventDeleteCall with the given calendarID and eventID.
@@ -231,16 +319,29 @@ func (es *EventService) Delete(calendarID, eventID string) *EventDeleteCall {
 	}
 }
 
+// IfMatch makes the delete fail with ErrPreconditionFailed if the event has changed since it was read with the given etag.
+func (edc *EventDeleteCall) IfMatch(etag string) *EventDeleteCall {
+	edc.etag = etag
+	return edc
+}
+
 // Do executes the http delete to microsoft's graph api to delete the call's event.
 func (edc *EventDeleteCall) Do(ctx context.Context) error {
-	var path string
-	if edc.calendarID == "primary" {
-		path = fmt.Sprintf("/events/%s", edc.eventID)
-	} else {
-		path = fmt.Sprintf("/calendars/%s%s/%s", edc.calendarID, edc.service.basePath, edc.eventID)
-	}
-	if _, err := edc.service.session.Delete(ctx, path, nil, nil); err != nil {
+	if _, err := edc.batchRequest().do(ctx, edc.service.requester); err != nil {
 		return err
 	}
 	return nil
 }
+
+func (edc *EventDeleteCall) batchRequest() *callRequest {
+	path := edc.service.eventPath(edc.calendarID, edc.eventID)
+	return &callRequest{method: http.MethodDelete, path: path, header: ifMatchHeader(edc.etag)}
+}
+
+// eventPath returns the path of the given event, which is addressed directly for the primary calendar and through its calendar otherwise.
+func (es *EventService) eventPath(calendarID, eventID string) string {
+	if calendarID == "primary" {
+		return fmt.Sprintf("%s/%s", es.basePath, eventID)
+	}
+	return fmt.Sprintf("/calendars/%s%s/%s", calendarID, es.basePath, eventID)
+}
@@ -1,18 +1,25 @@
 package outlook
 
-import "context"
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/amhester/go-outlook/odata"
+)
 
 // FolderService manages communication with microsofts graph for folder resources.
 type FolderService struct {
-	session  *Session
-	basePath string
+	requester Requester
+	basePath  string
 }
 
 // NewFolderService returns a new instance of a FolderService.
-func NewFolderService(session *Session) *FolderService {
+func NewFolderService(requester Requester) *FolderService {
 	return &FolderService{
-		session:  session,
-		basePath: "/mailFolders",
+		requester: requester,
+		basePath:  "/mailFolders",
 	}
 }
 
@@ -21,6 +28,8 @@ type FolderListCall struct {
 	service    *FolderService
 	nextLink   string
 	maxResults int64
+	limit      int
+	query      odata.Query
 }
 
 // List returns a FolderListCall builder struct
@@ -37,26 +46,76 @@ func (flc *FolderListCall) MaxResults(pageSize int64) *FolderListCall {
 	return flc
 }
 
-// NextLink uses the link provided to set the $skip query parameter for the folder list call.
+// NextLink sets the link of the page to fetch, as returned in the NextLink of a previous result, which is followed verbatim.
 func (flc *FolderListCall) NextLink(link string) *FolderListCall {
 	flc.nextLink = link
 	return flc
 }
 
+// Filter sets the $filter query parameter for the folder list call, e.g. odata.Field("displayName").Eq("Archive").
+func (flc *FolderListCall) Filter(filter odata.Expr) *FolderListCall {
+	flc.query.Filter = filter
+	return flc
+}
+
+// OrderBy sets the $orderby query parameter for the folder list call, e.g. odata.Field("displayName").Asc().
+func (flc *FolderListCall) OrderBy(orders ...odata.Order) *FolderListCall {
+	flc.query.OrderBy = orders
+	return flc
+}
+
+// Select sets the $select query parameter for the folder list call, limiting the properties returned for each folder.
+func (flc *FolderListCall) Select(fields ...string) *FolderListCall {
+	flc.query.Select = fields
+	return flc
+}
+
+// Expand sets the $expand query parameter for the folder list call, including the given relationships of each folder.
+func (flc *FolderListCall) Expand(relationships ...string) *FolderListCall {
+	flc.query.Expand = relationships
+	return flc
+}
+
 // Do executes the folder list call, returning the folder list result.
 func (flc *FolderListCall) Do(ctx context.Context) (*FolderListResult, error) {
-	params := map[string]interface{}{
-		"$top":   flc.maxResults,
-		"$count": true,
-	}
-	if flc.nextLink != "" {
-		params["$skip"] = parsePageLink(flc.nextLink, "$skip")
-	}
-
 	var result FolderListResult
-	if _, err := flc.service.session.Get(ctx, flc.service.basePath, params, &result); err != nil {
+	if _, err := flc.request(&result).do(ctx, flc.service.requester); err != nil {
 		return nil, err
 	}
 
 	return &result, nil
 }
+
+// Limit caps the number of folders All collects. Zero, the default, collects every folder.
+func (flc *FolderListCall) Limit(limit int) *FolderListCall {
+	flc.limit = limit
+	return flc
+}
+
+// Pages executes the folder list call and follows every next link, calling fn with each page of results until there are none left or fn returns an error.
+func (flc *FolderListCall) Pages(ctx context.Context, fn func(*FolderListResult) error) error {
+	call := *flc
+	return pages(ctx, call.Do, func(nextLink string) { call.nextLink = nextLink }, fn)
+}
+
+// All executes the folder list call and follows every next link, returning the folders of every page up to the call's limit.
+func (flc *FolderListCall) All(ctx context.Context) ([]*Folder, error) {
+	return all(ctx, flc.Pages, flc.limit)
+}
+
+func (flc *FolderListCall) request(result interface{}) *callRequest {
+	if flc.nextLink != "" {
+		return &callRequest{method: http.MethodGet, path: flc.nextLink, result: result}
+	}
+
+	params := url.Values{}
+	params.Set("$top", strconv.FormatInt(flc.maxResults, 10))
+	params.Set("$count", "true")
+	flc.query.Apply(params)
+
+	return &callRequest{method: http.MethodGet, path: flc.service.basePath, params: params, result: result}
+}
+
+func (flc *FolderListCall) batchRequest() *callRequest {
+	return flc.request(&FolderListResult{})
+}
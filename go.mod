@@ -0,0 +1,3 @@
+module github.com/amhester/go-outlook
+
+go 1.23
@@ -0,0 +1,108 @@
+package outlook
+
+import (
+	"context"
+	"iter"
+)
+
+// Items returns an iterator over the calendars of every page of the call, up to its limit, which fetches each page only once the previous one has been ranged over.
+// Breaking out of the loop stops any further requests, and a failed request is yielded as the loop's final error.
+func (clc *CalendarListCall) Items(ctx context.Context) iter.Seq2[*Calendar, error] {
+	return items(ctx, clc.Pages, clc.limit)
+}
+
+// Items returns an iterator over the events of every page of the call, up to its limit, which fetches each page only once the previous one has been ranged over.
+// Breaking out of the loop stops any further requests, and a failed request is yielded as the loop's final error.
+func (elc *EventListCall) Items(ctx context.Context) iter.Seq2[*Event, error] {
+	return items(ctx, elc.Pages, elc.limit)
+}
+
+// Items returns an iterator over the folders of every page of the call, up to its limit, which fetches each page only once the previous one has been ranged over.
+// Breaking out of the loop stops any further requests, and a failed request is yielded as the loop's final error.
+func (flc *FolderListCall) Items(ctx context.Context) iter.Seq2[*Folder, error] {
+	return items(ctx, flc.Pages, flc.limit)
+}
+
+// Items returns an iterator over the messages of every page of the call, up to its limit, which fetches each page only once the previous one has been ranged over.
+// Breaking out of the loop stops any further requests, and a failed request is yielded as the loop's final error.
+func (mlc *MessageListCall) Items(ctx context.Context) iter.Seq2[*Message, error] {
+	return items(ctx, mlc.Pages, mlc.limit)
+}
+
+// Items returns an iterator over the matching messages of every page of the call, up to its limit, which fetches each page only once the previous one has been ranged over.
+// Breaking out of the loop stops any further requests, and a failed request is yielded as the loop's final error.
+func (msc *MessageSearchCall) Items(ctx context.Context) iter.Seq2[*Message, error] {
+	return items(ctx, msc.Pages, msc.limit)
+}
+
+// listResult a page of the results of a list call, such as a CalendarListResult.
+type listResult[T any] interface {
+	values() []T
+	nextPage() string
+}
+
+func (result *CalendarListResult) values() []*Calendar { return result.Value }
+func (result *CalendarListResult) nextPage() string    { return result.NextLink }
+func (result *EventListResult) values() []*Event       { return result.Value }
+func (result *EventListResult) nextPage() string       { return result.NextLink }
+func (result *FolderListResult) values() []*Folder     { return result.Value }
+func (result *FolderListResult) nextPage() string      { return result.NextLink }
+func (result *MessageListResult) values() []*Message   { return result.Value }
+func (result *MessageListResult) nextPage() string     { return result.NextLink }
+
+// pages implements the Pages method of a list call: it fetches a page with do and calls fn with it, then has follow point the call at the
+// next link, until there are no pages left or fn returns an error.
+func pages[R listResult[T], T any](ctx context.Context, do func(context.Context) (R, error), follow func(nextLink string), fn func(R) error) error {
+	for {
+		result, err := do(ctx)
+		if err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+		if result.nextPage() == "" {
+			return nil
+		}
+		follow(result.nextPage())
+	}
+}
+
+// all implements the All method of a list call, collecting the values of every page up to limit if it is set.
+// The values collected before a failed request are returned along with its error.
+func all[R listResult[T], T any](ctx context.Context, pages func(context.Context, func(R) error) error, limit int) ([]T, error) {
+	var collected []T
+	for value, err := range items(ctx, pages, limit) {
+		if err != nil {
+			return collected, err
+		}
+		collected = append(collected, value)
+	}
+	return collected, nil
+}
+
+// items adapts a list call's Pages method to an iterator over the values of its pages, stopping after limit values if limit is set.
+func items[R listResult[T], T any](ctx context.Context, pages func(context.Context, func(R) error) error, limit int) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		yielded := 0
+		err := pages(ctx, func(result R) error {
+			for _, value := range result.values() {
+				if limit > 0 && yielded >= limit {
+					return errStopPaging
+				}
+				yielded++
+				if !yield(value, nil) {
+					return errStopPaging
+				}
+			}
+			if limit > 0 && yielded >= limit {
+				return errStopPaging
+			}
+			return nil
+		})
+		if err != nil && err != errStopPaging {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
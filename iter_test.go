@@ -0,0 +1,108 @@
+package outlook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// pageRequester answers list requests with the json pages configured for their paths, failing requests to any other path.
+type pageRequester struct {
+	pages    map[string]string
+	requests []string
+}
+
+func (r *pageRequester) Get(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodGet, url, nil, nil, nil, result)
+}
+
+func (r *pageRequester) Post(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodPost, url, nil, nil, data, result)
+}
+
+func (r *pageRequester) Patch(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodPatch, url, nil, nil, data, result)
+}
+
+func (r *pageRequester) Delete(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodDelete, url, nil, nil, nil, result)
+}
+
+func (r *pageRequester) Query(ctx context.Context, method, url string, params url.Values, header http.Header, data interface{}, result interface{}) (*http.Response, error) {
+	r.requests = append(r.requests, url)
+	page, ok := r.pages[url]
+	if !ok {
+		return nil, &ErrStatusCode{Code: http.StatusNotFound}
+	}
+	return &http.Response{StatusCode: http.StatusOK}, json.Unmarshal([]byte(page), result)
+}
+
+func messagePages() *pageRequester {
+	return &pageRequester{pages: map[string]string{
+		"/mailFolders/inbox/messages":                         `{"value":[{"id":"1"},{"id":"2"}],"@odata.nextLink":"https://graph.microsoft.com/v1.0/me/messages?page=2"}`,
+		"https://graph.microsoft.com/v1.0/me/messages?page=2": `{"value":[{"id":"3"}],"@odata.nextLink":"https://graph.microsoft.com/v1.0/me/messages?page=3"}`,
+		"https://graph.microsoft.com/v1.0/me/messages?page=3": `{"value":[{"id":"4"}]}`,
+	}}
+}
+
+func messageIDs(messages []*Message) string {
+	var ids string
+	for _, message := range messages {
+		ids += message.ID
+	}
+	return ids
+}
+
+func TestListCallAllFollowsEveryPage(t *testing.T) {
+	requester := messagePages()
+	messages, err := NewRequesterSession(requester).Messages().List("inbox").All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messageIDs(messages); got != "1234" {
+		t.Errorf("All() returned messages %s, want 1234", got)
+	}
+}
+
+func TestListCallAllStopsAtLimit(t *testing.T) {
+	requester := messagePages()
+	messages, err := NewRequesterSession(requester).Messages().List("inbox").Limit(3).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messageIDs(messages); got != "123" {
+		t.Errorf("All() returned messages %s, want 123", got)
+	}
+	if len(requester.requests) != 2 {
+		t.Errorf("made %d requests, want the two pages holding the first three messages", len(requester.requests))
+	}
+}
+
+func TestListCallAllReturnsPagesBeforeAnError(t *testing.T) {
+	requester := messagePages()
+	delete(requester.pages, "https://graph.microsoft.com/v1.0/me/messages?page=3")
+	messages, err := NewRequesterSession(requester).Messages().List("inbox").All(context.Background())
+	var statusErr *ErrStatusCode
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Errorf("All() error = %v, want the failed page's 404", err)
+	}
+	if got := messageIDs(messages); got != "123" {
+		t.Errorf("All() returned messages %s, want those of the pages before the error", got)
+	}
+}
+
+func TestListCallPagesStopsOnCallbackError(t *testing.T) {
+	requester := messagePages()
+	stop := errors.New("stop")
+	calls := 0
+	err := NewRequesterSession(requester).Messages().List("inbox").Pages(context.Background(), func(result *MessageListResult) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 || len(requester.requests) != 1 {
+		t.Errorf("Pages() = %v after %d callbacks and %d requests, want the callback's error after one page", err, calls, len(requester.requests))
+	}
+}
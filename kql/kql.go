@@ -0,0 +1,165 @@
+// Package kql builds the keyword query language (KQL) queries microsoft's graph api accepts in the $search parameter of message requests,
+// with values quoted as KQL expects.
+package kql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateFormat the format of the dates compared against by date restrictions such as received>=2024-01-31.
+const DateFormat = "2006-01-02"
+
+// Query a KQL query, which can be searched for on its own or combined with others.
+type Query interface {
+	String() string
+}
+
+type query string
+
+func (q query) String() string {
+	return string(q)
+}
+
+// Raw returns a query written by hand, for anything the builder doesn't cover. It is used verbatim.
+func Raw(kql string) Query {
+	return query(kql)
+}
+
+// Term returns a query matching text in any of a message's searchable properties. Text holding spaces or KQL syntax is searched for as a phrase.
+func Term(text string) Query {
+	return query(Value(text))
+}
+
+// Phrase returns a query matching the exact sequence of words in text in any of a message's searchable properties.
+func Phrase(text string) Query {
+	return query(quote(text))
+}
+
+// Property returns a query matching value in the named property, e.g. Property("cc", "ann@contoso.com") for cc:ann@contoso.com.
+func Property(name, value string) Query {
+	return query(fmt.Sprintf("%s:%s", name, Value(value)))
+}
+
+// From returns a query matching messages from the given address or display name.
+func From(sender string) Query {
+	return Property("from", sender)
+}
+
+// To returns a query matching messages to the given address or display name.
+func To(recipient string) Query {
+	return Property("to", recipient)
+}
+
+// Participants returns a query matching messages from, to, cc'ing or bcc'ing the given address or display name.
+func Participants(participant string) Query {
+	return Property("participants", participant)
+}
+
+// Subject returns a query matching text in the subject of messages.
+func Subject(text string) Query {
+	return Property("subject", text)
+}
+
+// Body returns a query matching text in the body of messages.
+func Body(text string) Query {
+	return Property("body", text)
+}
+
+// Attachment returns a query matching the file name of messages' attachments.
+func Attachment(name string) Query {
+	return Property("attachment", name)
+}
+
+// HasAttachments returns a query matching messages which either do or don't have attachments.
+func HasAttachments(has bool) Query {
+	return query(fmt.Sprintf("hasAttachments:%t", has))
+}
+
+// DateProperty a date property of messages which can be restricted to a range of dates. Dates are those of the given times in utc,
+// which is how graph compares them.
+type DateProperty string
+
+const (
+	// Received the date messages were received.
+	Received DateProperty = "received"
+	// Sent the date messages were sent.
+	Sent DateProperty = "sent"
+)
+
+// On returns a query matching messages on the date of t.
+func (d DateProperty) On(t time.Time) Query {
+	return d.compare("=", t)
+}
+
+// Gt returns a query matching messages after the date of t.
+func (d DateProperty) Gt(t time.Time) Query {
+	return d.compare(">", t)
+}
+
+// Ge returns a query matching messages on or after the date of t, e.g. received>=2024-01-31.
+func (d DateProperty) Ge(t time.Time) Query {
+	return d.compare(">=", t)
+}
+
+// Lt returns a query matching messages before the date of t.
+func (d DateProperty) Lt(t time.Time) Query {
+	return d.compare("<", t)
+}
+
+// Le returns a query matching messages on or before the date of t.
+func (d DateProperty) Le(t time.Time) Query {
+	return d.compare("<=", t)
+}
+
+func (d DateProperty) compare(op string, t time.Time) Query {
+	return query(fmt.Sprintf("%s%s%s", d, op, t.UTC().Format(DateFormat)))
+}
+
+// And returns a query matching messages matched by every one of queries.
+func And(queries ...Query) Query {
+	return join("AND", queries)
+}
+
+// Or returns a query matching messages matched by any one of queries.
+func Or(queries ...Query) Query {
+	return join("OR", queries)
+}
+
+// Not returns a query matching messages which q doesn't match.
+func Not(q Query) Query {
+	return query(fmt.Sprintf("NOT (%s)", q))
+}
+
+func join(op string, queries []Query) Query {
+	var parts []string
+	for _, q := range queries {
+		if q != nil && q.String() != "" {
+			parts = append(parts, q.String())
+		}
+	}
+	if len(parts) == 1 {
+		return query(parts[0])
+	}
+	for i, part := range parts {
+		parts[i] = fmt.Sprintf("(%s)", part)
+	}
+	return query(strings.Join(parts, fmt.Sprintf(" %s ", op)))
+}
+
+// operators the words KQL reads as operators rather than terms, which must be quoted to be searched for.
+var operators = map[string]bool{"AND": true, "OR": true, "NOT": true, "NEAR": true, "ONEAR": true, "WORDS": true}
+
+// Value formats value as a KQL term, quoting it as a phrase if it is empty or holds spaces, KQL syntax or an operator.
+func Value(value string) string {
+	if value == "" || operators[strings.ToUpper(value)] || strings.ContainsAny(value, " \t\r\n\"():<>=") {
+		return quote(value)
+	}
+	return value
+}
+
+// quote returns text as a KQL phrase. KQL has no escape for double quotes within a phrase, so any are dropped.
+func quote(text string) string {
+	return fmt.Sprintf("\"%s\"", strings.ReplaceAll(text, "\"", ""))
+}
@@ -0,0 +1,37 @@
+package kql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueries(t *testing.T) {
+	// Late on the 31st in New York is already February 1st in utc
+	evening := time.Date(2024, 1, 31, 22, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		query Query
+		want  string
+	}{
+		{Term("report"), "report"},
+		{Term("weekly report"), `"weekly report"`},
+		{Term("OR"), `"OR"`},
+		{Term(""), `""`},
+		{Phrase(`say "hi"`), `"say hi"`},
+		{From("ann@contoso.com"), "from:ann@contoso.com"},
+		{Subject("weekly report"), `subject:"weekly report"`},
+		{Property("cc", "a:b"), `cc:"a:b"`},
+		{HasAttachments(true), "hasAttachments:true"},
+		{Received.Ge(evening), "received>=2024-02-01"},
+		{Sent.On(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)), "sent=2024-01-31"},
+		{Received.Lt(evening), "received<2024-02-01"},
+		{And(From("ann"), nil, Subject("report")), "(from:ann) AND (subject:report)"},
+		{Or(Term("report")), "report"},
+		{Not(Or(From("ann"), From("bob"))), "NOT ((from:ann) OR (from:bob))"},
+	}
+	for _, tt := range tests {
+		if got := tt.query.String(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -3,29 +3,51 @@ package outlook
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/amhester/go-outlook/kql"
+	"github.com/amhester/go-outlook/odata"
 )
 
 // MessageService manages communication with microsofts graph for message resources.
 type MessageService struct {
-	session  *Session
-	basePath string
+	requester Requester
+	basePath  string
 }
 
 // NewMessageService returns a new instance of a MessageService.
-func NewMessageService(session *Session) *MessageService {
+func NewMessageService(requester Requester) *MessageService {
 	return &MessageService{
-		session:  session,
-		basePath: "/messages",
+		requester: requester,
+		basePath:  "/messages",
 	}
 }
 
+// MessageDateField a datetime property of a message which a MessageListCall's time window can filter on.
+type MessageDateField string
+
+const (
+	// MessageReceived the time the message was received, which message list calls filter on by default.
+	MessageReceived MessageDateField = "receivedDateTime"
+	// MessageSent the time the message was sent.
+	MessageSent MessageDateField = "sentDateTime"
+	// MessageCreated the time the message was created.
+	MessageCreated MessageDateField = "createdDateTime"
+)
+
 // MessageListCall struct allowing for fluent style configuration of calls to the message list endpoint.
 type MessageListCall struct {
 	service    *MessageService
 	folderID   string
 	nextLink   string
 	maxResults int64
+	limit      int
+	query      odata.Query
+	dateField  MessageDateField
 	startTime  time.Time
 	endTime    time.Time
 }
@@ -36,6 +58,7 @@ func (ms *MessageService) List(folderID string) *MessageListCall {
 		service:    ms,
 		maxResults: 10,
 		folderID:   folderID,
+		dateField:  MessageReceived,
 	}
 }
 
@@ -45,42 +68,245 @@ func (mlc *MessageListCall) MaxResults(pageSize int64) *MessageListCall {
 	return mlc
 }
 
-// NextLink uses the link provided to set the $skip query parameter for the message list call.
+// NextLink sets the link of the page to fetch, as returned in the NextLink of a previous result, which is followed verbatim.
 func (mlc *MessageListCall) NextLink(link string) *MessageListCall {
 	mlc.nextLink = link
 	return mlc
 }
 
-// StartTime sets the startDateTime query parameter for the message list call.
+// StartTime limits the message list call to messages at or after start, filtering on the call's DateField.
 func (mlc *MessageListCall) StartTime(start time.Time) *MessageListCall {
 	mlc.startTime = start
 	return mlc
 }
 
-// EndTime sets the endDateTime query parameter for the message list call.
+// EndTime limits the message list call to messages before end, filtering on the call's DateField.
 func (mlc *MessageListCall) EndTime(end time.Time) *MessageListCall {
 	mlc.endTime = end
 	return mlc
 }
 
+// DateField sets the property the StartTime and EndTime window filters on. An empty field, like leaving it unset, means MessageReceived.
+func (mlc *MessageListCall) DateField(field MessageDateField) *MessageListCall {
+	mlc.dateField = field
+	return mlc
+}
+
+// Filter sets the $filter query parameter for the message list call, e.g. odata.Field("isRead").Eq(false).
+// Any StartTime and EndTime window is combined with it.
+func (mlc *MessageListCall) Filter(filter odata.Expr) *MessageListCall {
+	mlc.query.Filter = filter
+	return mlc
+}
+
+// OrderBy sets the $orderby query parameter for the message list call, e.g. odata.Field("receivedDateTime").Desc().
+// With a StartTime or EndTime window the window's DateField always leads the order, newest first unless it is given here, as graph requires.
+func (mlc *MessageListCall) OrderBy(orders ...odata.Order) *MessageListCall {
+	mlc.query.OrderBy = orders
+	return mlc
+}
+
+// Select sets the $select query parameter for the message list call, limiting the properties returned for each message.
+func (mlc *MessageListCall) Select(fields ...string) *MessageListCall {
+	mlc.query.Select = fields
+	return mlc
+}
+
+// Expand sets the $expand query parameter for the message list call, including the given relationships of each message.
+func (mlc *MessageListCall) Expand(relationships ...string) *MessageListCall {
+	mlc.query.Expand = relationships
+	return mlc
+}
+
 // Do executes the message list call, returning the message list result.
 func (mlc *MessageListCall) Do(ctx context.Context) (*MessageListResult, error) {
-	params := map[string]interface{}{
-		"$top":          mlc.maxResults,
-		"$count":        true,
-		"startDateTime": mlc.startTime.Format(DefaultQueryDateTimeFormat),
-		"endDateTime":   mlc.endTime.Format(DefaultQueryDateTimeFormat),
+	var result MessageListResult
+	if _, err := mlc.request(&result).do(ctx, mlc.service.requester); err != nil {
+		return nil, err
 	}
+
+	return &result, nil
+}
+
+// Limit caps the number of messages All collects. Zero, the default, collects every message.
+func (mlc *MessageListCall) Limit(limit int) *MessageListCall {
+	mlc.limit = limit
+	return mlc
+}
+
+// Pages executes the message list call and follows every next link, calling fn with each page of results until there are none left or fn returns an error.
+func (mlc *MessageListCall) Pages(ctx context.Context, fn func(*MessageListResult) error) error {
+	call := *mlc
+	return pages(ctx, call.Do, func(nextLink string) { call.nextLink = nextLink }, fn)
+}
+
+// All executes the message list call and follows every next link, returning the messages of every page up to the call's limit.
+func (mlc *MessageListCall) All(ctx context.Context) ([]*Message, error) {
+	return all(ctx, mlc.Pages, mlc.limit)
+}
+
+func (mlc *MessageListCall) request(result interface{}) *callRequest {
 	if mlc.nextLink != "" {
-		params["$skip"] = parsePageLink(mlc.nextLink, "$skip")
+		return &callRequest{method: http.MethodGet, path: mlc.nextLink, result: result}
 	}
 
+	params := url.Values{}
+	params.Set("$top", strconv.FormatInt(mlc.maxResults, 10))
+	params.Set("$count", "true")
+	query := mlc.windowQuery()
+	query.Apply(params)
+
 	path := fmt.Sprintf("/mailFolders/%s%s", mlc.folderID, mlc.service.basePath)
 
+	return &callRequest{method: http.MethodGet, path: path, params: params, result: result}
+}
+
+// windowQuery returns the call's query with its time window, if it has one, added to the filter. The window comes first and its field
+// is moved to the front of the order, or added there descending, since graph rejects an $orderby whose properties don't lead the $filter.
+func (mlc *MessageListCall) windowQuery() odata.Query {
+	query := mlc.query
+	dateField := mlc.dateField
+	if dateField == "" {
+		dateField = MessageReceived
+	}
+	field := odata.Field(dateField)
+	var window []odata.Expr
+	if !mlc.startTime.IsZero() {
+		window = append(window, field.Ge(mlc.startTime))
+	}
+	if !mlc.endTime.IsZero() {
+		window = append(window, field.Lt(mlc.endTime))
+	}
+	if len(window) == 0 {
+		return query
+	}
+
+	query.Filter = odata.And(append(window, query.Filter)...)
+	lead := field.Desc()
+	var orders []odata.Order
+	for _, order := range query.OrderBy {
+		if strings.SplitN(string(order), " ", 2)[0] == string(dateField) {
+			lead = order
+			continue
+		}
+		orders = append(orders, order)
+	}
+	query.OrderBy = append([]odata.Order{lead}, orders...)
+	return query
+}
+
+func (mlc *MessageListCall) batchRequest() *callRequest {
+	return mlc.request(&MessageListResult{})
+}
+
+// MessageSearchCall struct allowing for fluent style configuration of calls searching messages with $search.
+// Graph returns search results newest first and won't combine $search with $orderby or $filter, so the call offers neither.
+type MessageSearchCall struct {
+	service    *MessageService
+	search     kql.Query
+	folderID   string
+	nextLink   string
+	maxResults int64
+	limit      int
+	query      odata.Query
+}
+
+// Search returns a MessageSearchCall builder struct, finding the messages of every folder which match the KQL query,
+// e.g. kql.And(kql.From("ann@contoso.com"), kql.Received.Ge(since)).
+func (ms *MessageService) Search(query kql.Query) *MessageSearchCall {
+	return &MessageSearchCall{
+		service:    ms,
+		search:     query,
+		maxResults: 10,
+	}
+}
+
+// Folder scopes the message search call to the messages of a single folder, which may be given by a well-known name such as inbox.
+func (msc *MessageSearchCall) Folder(folderID string) *MessageSearchCall {
+	msc.folderID = folderID
+	return msc
+}
+
+// MaxResults sets the $top query parameter for the message search call.
+func (msc *MessageSearchCall) MaxResults(pageSize int64) *MessageSearchCall {
+	msc.maxResults = pageSize
+	return msc
+}
+
+// NextLink sets the link of the page to fetch, as returned in the NextLink of a previous result, which is followed verbatim.
+// Search results are paged with a $skiptoken in the link rather than $skip, so it is the only way to reach later pages.
+func (msc *MessageSearchCall) NextLink(link string) *MessageSearchCall {
+	msc.nextLink = link
+	return msc
+}
+
+// Select sets the $select query parameter for the message search call, limiting the properties returned for each message.
+func (msc *MessageSearchCall) Select(fields ...string) *MessageSearchCall {
+	msc.query.Select = fields
+	return msc
+}
+
+// Expand sets the $expand query parameter for the message search call, including the given relationships of each message.
+func (msc *MessageSearchCall) Expand(relationships ...string) *MessageSearchCall {
+	msc.query.Expand = relationships
+	return msc
+}
+
+// Do executes the message search call, returning the first page of matching messages.
+func (msc *MessageSearchCall) Do(ctx context.Context) (*MessageListResult, error) {
 	var result MessageListResult
-	if _, err := mlc.service.session.Get(ctx, path, params, &result); err != nil {
+	if _, err := msc.request(&result).do(ctx, msc.service.requester); err != nil {
 		return nil, err
 	}
 
 	return &result, nil
 }
+
+// Limit caps the number of messages All collects. Zero, the default, collects every message.
+func (msc *MessageSearchCall) Limit(limit int) *MessageSearchCall {
+	msc.limit = limit
+	return msc
+}
+
+// Pages executes the message search call and follows every next link, calling fn with each page of results until there are none left or fn returns an error.
+func (msc *MessageSearchCall) Pages(ctx context.Context, fn func(*MessageListResult) error) error {
+	call := *msc
+	return pages(ctx, call.Do, func(nextLink string) { call.nextLink = nextLink }, fn)
+}
+
+// All executes the message search call and follows every next link, returning the matching messages of every page up to the call's limit.
+func (msc *MessageSearchCall) All(ctx context.Context) ([]*Message, error) {
+	return all(ctx, msc.Pages, msc.limit)
+}
+
+func (msc *MessageSearchCall) request(result interface{}) *callRequest {
+	if msc.nextLink != "" {
+		return &callRequest{method: http.MethodGet, path: msc.nextLink, result: result}
+	}
+
+	params := url.Values{}
+	params.Set("$top", strconv.FormatInt(msc.maxResults, 10))
+	params.Set("$search", searchParam(msc.search))
+	msc.query.Apply(params)
+
+	path := msc.service.basePath
+	if msc.folderID != "" {
+		path = fmt.Sprintf("/mailFolders/%s%s", msc.folderID, msc.service.basePath)
+	}
+
+	return &callRequest{method: http.MethodGet, path: path, params: params, result: result}
+}
+
+func (msc *MessageSearchCall) batchRequest() *callRequest {
+	return msc.request(&MessageListResult{})
+}
+
+// searchParam returns query as the value of a $search parameter, which graph expects wrapped in double quotes with any within it escaped.
+func searchParam(query kql.Query) string {
+	var search string
+	if query != nil {
+		search = query.String()
+	}
+	search = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(search)
+	return fmt.Sprintf("\"%s\"", search)
+}
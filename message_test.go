@@ -0,0 +1,103 @@
+package outlook
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/amhester/go-outlook/odata"
+)
+
+func TestMessageListWindowQuery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	messages := NewMessageService(nil)
+
+	tests := []struct {
+		name    string
+		call    *MessageListCall
+		filter  string
+		orderBy string
+	}{
+		{"no window", messages.List("inbox"), "", ""},
+		{
+			"received by default",
+			messages.List("inbox").StartTime(start).EndTime(end),
+			"(receivedDateTime ge 2024-01-01T00:00:00Z) and (receivedDateTime lt 2024-02-01T00:00:00Z)",
+			"receivedDateTime desc",
+		},
+		{
+			"empty field",
+			messages.List("inbox").DateField("").StartTime(start),
+			"receivedDateTime ge 2024-01-01T00:00:00Z",
+			"receivedDateTime desc",
+		},
+		{
+			"sent",
+			messages.List("inbox").DateField(MessageSent).EndTime(end),
+			"sentDateTime lt 2024-02-01T00:00:00Z",
+			"sentDateTime desc",
+		},
+		{
+			"custom order",
+			messages.List("inbox").StartTime(start).OrderBy(odata.Field("subject").Asc(), odata.Field("importance").Desc()),
+			"receivedDateTime ge 2024-01-01T00:00:00Z",
+			"receivedDateTime desc,subject asc,importance desc",
+		},
+		{
+			"custom order on the window field",
+			messages.List("inbox").EndTime(end).OrderBy(odata.Field("subject").Asc(), odata.Field("receivedDateTime").Asc()),
+			"receivedDateTime lt 2024-02-01T00:00:00Z",
+			"receivedDateTime asc,subject asc",
+		},
+		{
+			"custom order without a window",
+			messages.List("inbox").OrderBy(odata.Field("subject").Asc()),
+			"",
+			"subject asc",
+		},
+		{
+			"zero value call",
+			&MessageListCall{service: messages, startTime: start},
+			"receivedDateTime ge 2024-01-01T00:00:00Z",
+			"receivedDateTime desc",
+		},
+	}
+	for _, tt := range tests {
+		params := url.Values{}
+		query := tt.call.windowQuery()
+		query.Apply(params)
+		if got := params.Get("$filter"); got != tt.filter {
+			t.Errorf("%s: $filter = %q, want %q", tt.name, got, tt.filter)
+		}
+		if got := params.Get("$orderby"); got != tt.orderBy {
+			t.Errorf("%s: $orderby = %q, want %q", tt.name, got, tt.orderBy)
+		}
+	}
+}
+
+func TestMessageListRequestParams(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	messages := NewMessageService(nil)
+
+	for name, call := range map[string]*MessageListCall{
+		"no window": messages.List("inbox"),
+		"window":    messages.List("inbox").StartTime(start).EndTime(start.AddDate(0, 1, 0)),
+	} {
+		req := call.request(&MessageListResult{})
+		if req.path != "/mailFolders/inbox/messages" {
+			t.Errorf("%s: path %s", name, req.path)
+		}
+		// The window only reaches graph through $filter, which is all the messages endpoint understands
+		for key := range req.params {
+			switch key {
+			case "$top", "$count", "$filter", "$orderby":
+			default:
+				t.Errorf("%s: sent parameter %s=%s", name, key, req.params.Get(key))
+			}
+		}
+		if req.params.Get("$top") != "10" || req.params.Get("$count") != "true" {
+			t.Errorf("%s: params %v", name, req.params)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package outlook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps the http.RoundTripper a client sends its requests through, e.g. to add proxies, tracing, logging or fault injection.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc an adapter allowing an ordinary function to be used as an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type accessTokenContextKey struct{}
+
+// SetClientHTTPClient returns a ClientOpt function which sets the http client requests are sent with. The client itself is never modified.
+func SetClientHTTPClient(httpClient *http.Client) ClientOpt {
+	return func(c *Client) {
+		c.setHTTPClient(httpClient)
+	}
+}
+
+// SetClientMiddleware returns a ClientOpt function which adds middleware to the client's transport. The first middleware given sees requests first.
+func SetClientMiddleware(middleware ...Middleware) ClientOpt {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// SetHTTPClient fluent configuration of the http client requests are sent with.
+func (client *Client) SetHTTPClient(httpClient *http.Client) *Client {
+	client.setHTTPClient(httpClient)
+	client.buildTransport()
+	return client
+}
+
+// Use fluent configuration of middleware added to the client's transport, after any already in use. The first middleware given sees requests first.
+func (client *Client) Use(middleware ...Middleware) *Client {
+	client.middleware = append(client.middleware, middleware...)
+	client.buildTransport()
+	return client
+}
+
+// setHTTPClient keeps a copy of httpClient to send requests with, along with its transport, which the client's middleware is composed around.
+func (client *Client) setHTTPClient(httpClient *http.Client) {
+	if httpClient == nil {
+		httpClient = DefaultClient
+	}
+	copied := *httpClient
+	client.client = &copied
+	client.transport = httpClient.Transport
+}
+
+// buildTransport composes the client's middleware, with bearer token injection outermost, around the transport of its http client.
+func (client *Client) buildTransport() {
+	transport := client.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(client.middleware) - 1; i >= 0; i-- {
+		transport = client.middleware[i](transport)
+	}
+	client.client.Transport = bearerAuth(client.baseURL.Host, transport)
+}
+
+// withAccessToken returns a context carrying the access token bearerAuth should authorize requests with.
+func withAccessToken(ctx context.Context, accessToken string) context.Context {
+	return context.WithValue(ctx, accessTokenContextKey{}, accessToken)
+}
+
+// bearerAuth a Middleware which authorizes requests to the graph host with the access token their session put in the request's context.
+// Requests to any other host, such as microsoft's token endpoint or the target of a redirect, are passed through untouched, so the token never leaves graph.
+func bearerAuth(graphHost string, next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		accessToken, _ := req.Context().Value(accessTokenContextKey{}).(string)
+		if accessToken == "" || !strings.EqualFold(req.URL.Host, graphHost) {
+			return next.RoundTrip(req)
+		}
+		authed := req.Clone(req.Context())
+		authed.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		return next.RoundTrip(authed)
+	})
+}
@@ -0,0 +1,71 @@
+package outlook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerAuthOnlyAuthorizesGraphHost(t *testing.T) {
+	leaked := make(chan string, 1)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked <- r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", mediaType)
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer other.Close()
+
+	authorized := make(chan string, 1)
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorized <- r.Header.Get("Authorization")
+		http.Redirect(w, r, other.URL+"/elsewhere", http.StatusFound)
+	}))
+	defer graph.Close()
+
+	client, err := NewClient(SetClientGraphHost(graph.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "secret-token"})
+
+	var result CalendarListResult
+	if _, err := session.Get(context.Background(), "/calendars", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-authorized; got != "Bearer secret-token" {
+		t.Errorf("graph got Authorization %q, want the session's token", got)
+	}
+	if got := <-leaked; got != "" {
+		t.Errorf("redirect target got Authorization %q, want none", got)
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var order []string
+	record := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	graph := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer graph.Close()
+
+	client, err := NewClient(SetClientGraphHost(graph.URL), SetClientMiddleware(record("first"), record("second")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Use(record("third"))
+	session := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "token"})
+	if _, err := session.Get(context.Background(), "/calendars", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "third" {
+		t.Errorf("middleware ran in order %v, want [first second third]", order)
+	}
+}
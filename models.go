@@ -29,8 +29,46 @@ type RefreshTokenResponse struct {
 	Scope        string `json:"scope"`
 }
 
+// DeviceCodeResponse microsoft device authorization response object
+type DeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+	Message         string `json:"message"`
+}
+
+// TokenErrorResponse microsoft token endpoint error object
+type TokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorCodes       []int  `json:"error_codes,omitempty"`
+	TraceID          string `json:"trace_id,omitempty"`
+	CorrelationID    string `json:"correlation_id,omitempty"`
+}
+
+// GraphError microsoft graph error object, as found under the error key of a failed response
+type GraphError struct {
+	Code       string           `json:"code,omitempty"`
+	Message    string           `json:"message,omitempty"`
+	InnerError *GraphInnerError `json:"innerError,omitempty"`
+}
+
+// GraphInnerError microsoft graph inner error object, carrying the ids microsoft support asks for along with any nested errors
+type GraphInnerError struct {
+	Code            string           `json:"code,omitempty"`
+	Message         string           `json:"message,omitempty"`
+	Date            string           `json:"date,omitempty"`
+	RequestID       string           `json:"request-id,omitempty"`
+	ClientRequestID string           `json:"client-request-id,omitempty"`
+	InnerError      *GraphInnerError `json:"innerError,omitempty"`
+}
+
 // FolderListResult struct representing a response from the outlook mailFolders endpoint
 type FolderListResult struct {
+	ServerResponse
+
 	Context  string    `json:"@odata.context,omitempty"`
 	NextLink string    `json:"@odata.nextLink,omitempty"`
 	Total    int64     `json:"@odata.count,omitempty"`
@@ -39,6 +77,9 @@ type FolderListResult struct {
 
 // Folder struct representing an outlook calendar object
 type Folder struct {
+	ServerResponse
+
+	ETag             string `json:"@odata.etag,omitempty"`
 	ID               string `json:"id,omitempty"`
 	DisplayName      string `json:"displayName,omitempty"`
 	ParentFolderID   string `json:"parentFolderId,omitempty"`
@@ -49,6 +90,8 @@ type Folder struct {
 
 // MessageListResult struct representing a response from the outlook messages endpoint
 type MessageListResult struct {
+	ServerResponse
+
 	Context  string     `json:"@odata.context,omitempty"`
 	NextLink string     `json:"@odata.nextLink,omitempty"`
 	Total    int64      `json:"@odata.count,omitempty"`
@@ -58,6 +101,9 @@ type MessageListResult struct {
 // Message microsoft message object
 // TODO: Add all fields from outlook
 type Message struct {
+	ServerResponse
+
+	ETag           string       `json:"@odata.etag,omitempty"`
 	ID             string       `json:"id,omitempty"`
 	MessageID      string       `json:"internetMessageId,omitempty"`
 	CreatedOn      string       `json:"createdDateTime,omitempty"`
@@ -68,6 +114,7 @@ type Message struct {
 	Importance     string       `json:"importance,omitempty"`
 	ConversationID string       `json:"conversationId,omitempty"`
 	IsRead         bool         `json:"isread,omitempty"`
+	HasAttachments bool         `json:"hasAttachments,omitempty"`
 	Body           *MessageBody `json:"body,omitempty"`
 	Sender         *Recipient   `json:"sender,omitempty"`
 	From           *Recipient   `json:"from,omitempty"`
@@ -102,6 +149,8 @@ type EmailAddress struct {
 
 // CalendarListResult you can tell by the way it is
 type CalendarListResult struct {
+	ServerResponse
+
 	Context  string      `json:"@odata.context,omitempty"`
 	NextLink string      `json:"@odata.nextLink,omitempty"`
 	Total    int64       `json:"@odata.count,omitempty"`
@@ -110,6 +159,9 @@ type CalendarListResult struct {
 
 // Calendar outlook calendar object
 type Calendar struct {
+	ServerResponse
+
+	ETag                string        `json:"@odata.etag,omitempty"`
 	ID                  string        `json:"id,omitempty"`
 	Name                string        `json:"name,omitempty"`
 	Color               string        `json:"color,omitempty"`
@@ -121,6 +173,8 @@ type Calendar struct {
 
 // EventListResult you can tell by the way it is
 type EventListResult struct {
+	ServerResponse
+
 	Context  string   `json:"@odata.context,omitempty"`
 	NextLink string   `json:"@odata.nextLink,omitempty"`
 	Total    int64    `json:"@odata.count,omitempty"`
@@ -158,6 +212,9 @@ const (
 // Event microsoft event object
 // TODO: Add all fields from outlook
 type Event struct {
+	ServerResponse
+
+	ETag                       string               `json:"@odata.etag,omitempty"`
 	ID                         string               `json:"id,omitempty"`
 	CreatedOn                  string               `json:"createdDateTime,omitempty"`
 	UpdatedOn                  string               `json:"lastModifiedDateTime,omitempty"`
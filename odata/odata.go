@@ -0,0 +1,230 @@
+// Package odata builds the OData query options microsoft's graph api accepts, such as $filter and $orderby, with literals escaped and formatted as graph expects.
+package odata
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DateTimeFormat the format of datetime literals, which graph expects in utc.
+const DateTimeFormat = "2006-01-02T15:04:05Z"
+
+// Expr a boolean expression which can be used as a $filter.
+type Expr interface {
+	String() string
+}
+
+type expr string
+
+func (e expr) String() string {
+	return string(e)
+}
+
+// Raw returns an expression written by hand, for anything the builder doesn't cover. It is used verbatim.
+func Raw(filter string) Expr {
+	return expr(filter)
+}
+
+// Field a property of a resource, which may be a path into a nested property such as emailAddress/address.
+type Field string
+
+// Path returns the nested property of the field with the given name, e.g. Field("from").Path("emailAddress/address").
+func (f Field) Path(name string) Field {
+	if f == "" {
+		return Field(name)
+	}
+	return Field(fmt.Sprintf("%s/%s", f, name))
+}
+
+// Eq returns an expression testing whether the field equals value.
+func (f Field) Eq(value interface{}) Expr {
+	return f.compare("eq", value)
+}
+
+// Ne returns an expression testing whether the field doesn't equal value.
+func (f Field) Ne(value interface{}) Expr {
+	return f.compare("ne", value)
+}
+
+// Gt returns an expression testing whether the field is greater than value.
+func (f Field) Gt(value interface{}) Expr {
+	return f.compare("gt", value)
+}
+
+// Ge returns an expression testing whether the field is greater than or equal to value.
+func (f Field) Ge(value interface{}) Expr {
+	return f.compare("ge", value)
+}
+
+// Lt returns an expression testing whether the field is less than value.
+func (f Field) Lt(value interface{}) Expr {
+	return f.compare("lt", value)
+}
+
+// Le returns an expression testing whether the field is less than or equal to value.
+func (f Field) Le(value interface{}) Expr {
+	return f.compare("le", value)
+}
+
+// In returns an expression testing whether the field equals any of the given values.
+func (f Field) In(values ...interface{}) Expr {
+	literals := make([]string, len(values))
+	for i, value := range values {
+		literals[i] = Literal(value)
+	}
+	return expr(fmt.Sprintf("%s in (%s)", f, strings.Join(literals, ",")))
+}
+
+// StartsWith returns an expression testing whether the string field starts with prefix.
+func (f Field) StartsWith(prefix string) Expr {
+	return expr(fmt.Sprintf("startswith(%s,%s)", f, Literal(prefix)))
+}
+
+// EndsWith returns an expression testing whether the string field ends with suffix.
+func (f Field) EndsWith(suffix string) Expr {
+	return expr(fmt.Sprintf("endswith(%s,%s)", f, Literal(suffix)))
+}
+
+// Contains returns an expression testing whether the string field contains substr.
+func (f Field) Contains(substr string) Expr {
+	return expr(fmt.Sprintf("contains(%s,%s)", f, Literal(substr)))
+}
+
+// Any returns an expression testing whether any item of the collection field satisfies the predicate, which is given the item to build it from,
+// e.g. Field("categories").Any(func(c Field) Expr { return c.Eq("Red") }) for categories/any(x:x eq 'Red').
+func (f Field) Any(predicate func(item Field) Expr) Expr {
+	return f.lambda("any", predicate)
+}
+
+// All returns an expression testing whether every item of the collection field satisfies the predicate, which is given the item to build it from.
+func (f Field) All(predicate func(item Field) Expr) Expr {
+	return f.lambda("all", predicate)
+}
+
+// Asc returns an ascending $orderby clause for the field.
+func (f Field) Asc() Order {
+	return Order(fmt.Sprintf("%s asc", f))
+}
+
+// Desc returns a descending $orderby clause for the field.
+func (f Field) Desc() Order {
+	return Order(fmt.Sprintf("%s desc", f))
+}
+
+func (f Field) compare(op string, value interface{}) Expr {
+	return expr(fmt.Sprintf("%s %s %s", f, op, Literal(value)))
+}
+
+// lambdaVariable matches the variables of the lambdas in a predicate.
+var lambdaVariable = regexp.MustCompile(`/(?:any|all)\(x(\d*):`)
+
+// lambdaPlaceholders counts the placeholders predicates are built with before their variable is known.
+var lambdaPlaceholders uint64
+
+// lambda builds an any or all lambda. Its variable is x, or x1, x2 and so on when the predicate has lambdas of its own, so an
+// outer variable is never shadowed by a nested one.
+func (f Field) lambda(op string, predicate func(item Field) Expr) Expr {
+	placeholder := fmt.Sprintf("\x00%d\x00", atomic.AddUint64(&lambdaPlaceholders, 1))
+	body := predicate(Field(placeholder)).String()
+	variable := "x"
+	depth := -1
+	for _, match := range lambdaVariable.FindAllStringSubmatch(body, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if n > depth {
+			depth = n
+		}
+	}
+	if depth >= 0 {
+		variable = fmt.Sprintf("x%d", depth+1)
+	}
+	return expr(fmt.Sprintf("%s/%s(%s:%s)", f, op, variable, strings.ReplaceAll(body, placeholder, variable)))
+}
+
+// And returns an expression testing whether every one of exprs is true.
+func And(exprs ...Expr) Expr {
+	return join("and", exprs)
+}
+
+// Or returns an expression testing whether any one of exprs is true.
+func Or(exprs ...Expr) Expr {
+	return join("or", exprs)
+}
+
+// Not returns an expression negating e.
+func Not(e Expr) Expr {
+	return expr(fmt.Sprintf("not (%s)", e))
+}
+
+func join(op string, exprs []Expr) Expr {
+	var parts []string
+	for _, e := range exprs {
+		if e != nil && e.String() != "" {
+			parts = append(parts, e.String())
+		}
+	}
+	if len(parts) == 1 {
+		return expr(parts[0])
+	}
+	for i, part := range parts {
+		parts[i] = fmt.Sprintf("(%s)", part)
+	}
+	return expr(strings.Join(parts, fmt.Sprintf(" %s ", op)))
+}
+
+// Literal formats value as an OData literal: strings are quoted with any quotes doubled, times are formatted in utc, and nil is null.
+func Literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("'%s'", strings.ReplaceAll(v, "'", "''"))
+	case time.Time:
+		return v.UTC().Format(DateTimeFormat)
+	case *time.Time:
+		if v == nil {
+			return "null"
+		}
+		return v.UTC().Format(DateTimeFormat)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	case fmt.Stringer:
+		return Literal(v.String())
+	}
+	return Literal(fmt.Sprintf("%v", value))
+}
+
+// Order an $orderby clause, such as receivedDateTime desc.
+type Order string
+
+// Query the OData query options of a call. The zero value sets none of them.
+type Query struct {
+	Filter  Expr
+	OrderBy []Order
+	Select  []string
+	Expand  []string
+}
+
+// Apply sets the query options which have been given on params.
+func (q *Query) Apply(params url.Values) {
+	if q.Filter != nil && q.Filter.String() != "" {
+		params.Set("$filter", q.Filter.String())
+	}
+	if len(q.OrderBy) > 0 {
+		orders := make([]string, len(q.OrderBy))
+		for i, order := range q.OrderBy {
+			orders[i] = string(order)
+		}
+		params.Set("$orderby", strings.Join(orders, ","))
+	}
+	if len(q.Select) > 0 {
+		params.Set("$select", strings.Join(q.Select, ","))
+	}
+	if len(q.Expand) > 0 {
+		params.Set("$expand", strings.Join(q.Expand, ","))
+	}
+}
@@ -0,0 +1,74 @@
+package odata
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestExpressions(t *testing.T) {
+	from := Field("from").Path("emailAddress/address")
+	received := time.Date(2024, 1, 31, 10, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{Field("subject").Eq("it's"), "subject eq 'it''s'"},
+		{Field("isRead").Ne(true), "isRead ne true"},
+		{Field("size").Gt(1024), "size gt 1024"},
+		{Field("receivedDateTime").Ge(received), "receivedDateTime ge 2024-01-31T15:00:00Z"},
+		{Field("flag").Eq(nil), "flag eq null"},
+		{Field("importance").In("low", "high"), "importance in ('low','high')"},
+		{from.EndsWith("@contoso.com"), "endswith(from/emailAddress/address,'@contoso.com')"},
+		{Not(Field("subject").Contains("x")), "not (contains(subject,'x'))"},
+		{And(Field("a").Eq(1), nil, Field("b").Eq(2)), "(a eq 1) and (b eq 2)"},
+		{Or(Field("a").Eq(1)), "a eq 1"},
+		{
+			Field("toRecipients").Any(func(r Field) Expr { return r.Path("emailAddress/address").Eq("bob@contoso.com") }),
+			"toRecipients/any(x:x/emailAddress/address eq 'bob@contoso.com')",
+		},
+		{
+			Field("attendees").Any(func(a Field) Expr {
+				return a.Path("proposals").All(func(p Field) Expr {
+					return And(p.Path("status").Eq("accepted"), a.Path("type").Eq("required"))
+				})
+			}),
+			"attendees/any(x1:x1/proposals/all(x:(x/status eq 'accepted') and (x1/type eq 'required')))",
+		},
+		{
+			Field("a").Any(func(a Field) Expr {
+				return Or(
+					a.Path("b").Any(func(b Field) Expr {
+						return b.Path("c").Any(func(c Field) Expr { return And(c.Eq(1), b.Path("d").Eq(2), a.Path("e").Eq(3)) })
+					}),
+					a.Path("f").Any(func(f Field) Expr { return f.Eq(4) }),
+				)
+			}),
+			"a/any(x2:(x2/b/any(x1:x1/c/any(x:(x eq 1) and (x1/d eq 2) and (x2/e eq 3)))) or (x2/f/any(x:x eq 4)))",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.expr.String(); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestQueryApply(t *testing.T) {
+	params := url.Values{}
+	query := Query{
+		Filter:  Field("isRead").Eq(false),
+		OrderBy: []Order{Field("receivedDateTime").Desc(), Field("subject").Asc()},
+		Select:  []string{"id", "subject"},
+	}
+	query.Apply(params)
+	want := url.Values{
+		"$filter":  {"isRead eq false"},
+		"$orderby": {"receivedDateTime desc,subject asc"},
+		"$select":  {"id,subject"},
+	}
+	if params.Encode() != want.Encode() {
+		t.Errorf("Apply set %v, want %v", params, want)
+	}
+}
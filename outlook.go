@@ -18,6 +18,14 @@ const (
 	ClientVersion = "0.1.0"
 	// DefaultBaseURL the root host url for the microsoft outlook api
 	DefaultBaseURL = "https://graph.microsoft.com/v1.0"
+	// DefaultGraphHost the host of microsoft's graph api in the global cloud
+	DefaultGraphHost = "https://graph.microsoft.com"
+	// DefaultAPIVersion the version of microsoft's graph api the sdk targets
+	DefaultAPIVersion = "v1.0"
+	// DefaultAuthorityHost the host of microsoft's identity platform in the global cloud
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+	// DefaultTenant the tenant used for authentication when none is configured, allowing both work and personal accounts
+	DefaultTenant = "common"
 	// DefaultOAuthTokenURL the url used to exchange a user's refreshToken for a usable accessToken
 	DefaultOAuthTokenURL = "https://login.microsoftonline.com/common/oauth2/v2.0/token"
 	// DefaultAuthScopes the set of permissions the client will request from the user
@@ -25,14 +33,15 @@ const (
 	// DefaultQueryDateTimeFormat time format for the datetime query parameters used in outlook
 	DefaultQueryDateTimeFormat = "2006-01-02T15:04:05Z"
 
-	mediaType = "application/json"
+	mediaType     = "application/json"
+	formMediaType = "application/x-www-form-urlencoded"
 )
 
 var (
 	// ErrNoDeltaLink error when our email paging fails to return a delta token at the end.
 	ErrNoDeltaLink = errors.New("no delta link on response")
 
-	// DefaultClient the http client that the sdk will use to make calls.
+	// DefaultClient the http client that the sdk will use to make calls, unless another is set with SetClientHTTPClient.
 	DefaultClient = &http.Client{Timeout: time.Second * 60}
 
 	// DefaultUserAgent the user agent to get passed in request headers on each call
@@ -40,15 +49,26 @@ var (
 )
 
 // Client manages communication with microsoft's graph api, specifically for Mail and Calendar.
+// A Client is safe for concurrent use by multiple goroutines once configured; the fluent setters should only be called before it is shared.
 type Client struct {
-	client      *http.Client
-	baseURL     *url.URL
-	userAgent   string
-	mediaType   string
-	appID       string
-	appSecret   string
-	redirectURI string
-	scope       string
+	client        *http.Client
+	transport     http.RoundTripper
+	middleware    []Middleware
+	baseURL       *url.URL
+	graphHost     string
+	authorityHost string
+	tenantID      string
+	userAgent     string
+	mediaType     string
+	appID         string
+	appSecret     string
+	certificate   *clientCertificate
+	redirectURI   string
+	scope         string
+	tokenStore    TokenStore
+	retryPolicy   *RetryPolicy
+	rateLimiter   *RateLimiter
+	hooks         []Hook
 }
 
 // ClientOpt functions to configure options on a Client.
@@ -89,22 +109,34 @@ func SetClientMediaType(mType string) ClientOpt {
 	}
 }
 
+// SetClientTokenStore returns a ClientOpt function which sets the store that sessions persist their tokens to.
+func SetClientTokenStore(store TokenStore) ClientOpt {
+	return func(c *Client) {
+		c.tokenStore = store
+	}
+}
+
 // NewClient returns a new instance of a Client with the given options set.
 func NewClient(opts ...ClientOpt) (*Client, error) {
-	baseURL, err := url.Parse(DefaultBaseURL)
-	if err != nil {
-		return nil, err
-	}
 	client := &Client{
-		client:    DefaultClient,
-		baseURL:   baseURL,
-		userAgent: DefaultUserAgent,
-		scope:     DefaultAuthScopes,
-		mediaType: mediaType,
+		graphHost:     DefaultGraphHost,
+		authorityHost: DefaultAuthorityHost,
+		tenantID:      DefaultTenant,
+		userAgent:     DefaultUserAgent,
+		scope:         DefaultAuthScopes,
+		mediaType:     mediaType,
+		retryPolicy:   DefaultRetryPolicy(),
 	}
+	client.setHTTPClient(DefaultClient)
 	for _, opt := range opts {
 		opt(client)
 	}
+	baseURL, err := url.Parse(fmt.Sprintf("%s/%s", client.graphHost, DefaultAPIVersion))
+	if err != nil {
+		return nil, err
+	}
+	client.baseURL = baseURL
+	client.buildTransport()
 	return client, nil
 }
 
@@ -138,8 +170,28 @@ func (client *Client) SetMediaType(mType string) *Client {
 	return client
 }
 
+// SetTokenStore fluent configuration of the store that sessions persist their tokens to.
+func (client *Client) SetTokenStore(store TokenStore) *Client {
+	client.tokenStore = store
+	return client
+}
+
+// apiPath returns the part of an absolute link to the client's graph api after the api's root, e.g. /me/events?$skiptoken=abc.
+func (client *Client) apiPath(link string) (string, error) {
+	root := client.baseURL.String()
+	if !strings.HasPrefix(link, root+"/") {
+		return "", ErrInvalidNextLink
+	}
+	return strings.TrimPrefix(link, root), nil
+}
+
 // NewRequest creates a new request with some reasonable defaults based on the client.
 func (client *Client) NewRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	return client.newRequest(ctx, method, path, client.mediaType, body)
+}
+
+// newRequest creates a new request whose body is encoded with the given media type, leaving the client's own mediaType untouched.
+func (client *Client) newRequest(ctx context.Context, method, path, mType string, body interface{}) (*http.Request, error) {
 	var fullURL string
 	pathURL, err := url.Parse(path)
 	if err != nil {
@@ -153,12 +205,12 @@ func (client *Client) NewRequest(ctx context.Context, method, path string, body
 
 	encodedBody := new(bytes.Buffer)
 	if body != nil {
-		switch client.mediaType {
+		switch mType {
 		case "application/json":
 			if err := json.NewEncoder(encodedBody).Encode(body); err != nil {
 				return nil, err
 			}
-		case "application/x-www-form-urlencoded":
+		case formMediaType:
 			if v, ok := body.(url.Values); ok {
 				bodyReader := strings.NewReader(v.Encode())
 				if _, err := io.Copy(encodedBody, bodyReader); err != nil {
@@ -170,21 +222,56 @@ func (client *Client) NewRequest(ctx context.Context, method, path string, body
 		}
 	}
 
-	req, err := http.NewRequest(method, fullURL, encodedBody)
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, encodedBody)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Content-Type", client.mediaType)
+	req.Header.Add("Content-Type", mType)
 	req.Header.Add("Accept", mediaType)
 	req.Header.Add("User-Agent", client.userAgent)
+	if clientRequestID := newClientRequestID(); clientRequestID != "" {
+		req.Header.Add(HeaderClientRequestID, clientRequestID)
+		req.Header.Add(HeaderReturnClientRequestID, "true")
+	}
 
 	return req, nil
 }
 
 // Do executes the given http request and will bind the response body with v. Returns the http response as well as any error.
+// Throttled and transiently failing requests are retried according to the client's RetryPolicy, keeping the same client-request-id.
 func (client *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*http.Response, error) {
+	return client.doLimited(ctx, req, v, "", 0)
+}
+
+// doLimited executes the given http request like Do, waiting on the client's RateLimiter before every attempt if a mailbox is given,
+// which graph counts the request against as the given number of requests.
+func (client *Client) doLimited(ctx context.Context, req *http.Request, v interface{}, mailbox string, requests int) (*http.Response, error) {
 	req = req.WithContext(ctx)
+	for attempt := 1; ; attempt++ {
+		release := func() {}
+		if client.rateLimiter != nil && mailbox != "" {
+			var err error
+			if release, err = client.rateLimiter.WaitN(ctx, mailbox, requests); err != nil {
+				return nil, err
+			}
+		}
+		response, err := client.attempt(ctx, req, attempt, v)
+		release()
+		delay, retry := client.retryPolicy.retryDelay(req, attempt, err)
+		if !retry {
+			return response, err
+		}
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return response, sleepErr
+		}
+		if rewindErr := rewindBody(req); rewindErr != nil {
+			return response, rewindErr
+		}
+	}
+}
+
+func (client *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
 	response, err := client.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -218,6 +305,50 @@ func (client *Client) Do(ctx context.Context, req *http.Request, v interface{})
 	return response, err
 }
 
+// NewAppSession returns a new app-only Session for the given tenant using the client_credentials grant.
+// App-only sessions have no signed in user, so ForUser must be used to pick the mailbox being accessed.
+func (client *Client) NewAppSession(ctx context.Context, tenantID string) (*Session, error) {
+	session, err := NewAppSession(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// NewSessionOnBehalfOf returns a new instance of a Session for the user who the given access token was issued to, using the on-behalf-of grant.
+func (client *Client) NewSessionOnBehalfOf(ctx context.Context, userAssertion string) (*Session, error) {
+	session, err := NewSessionOnBehalfOf(ctx, client, userAssertion)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// LoadSession returns a new instance of a Session using the tokens saved under key in the client's TokenStore.
+// The session keeps saving its tokens under key whenever they change.
+func (client *Client) LoadSession(ctx context.Context, key string) (*Session, error) {
+	if client.tokenStore == nil {
+		return nil, ErrNoTokenStore
+	}
+	token, err := client.tokenStore.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{
+		client:    client,
+		basePath:  "/me",
+		grantType: grantTypeRefreshToken,
+		tenantID:  client.tenantID,
+		auth: &sessionAuth{
+			accessToken:  token.AccessToken,
+			refreshToken: token.RefreshToken,
+			expiresAt:    token.Expiry,
+			storeKey:     key,
+		},
+	}
+	return session, nil
+}
+
 // NewSession returns a new instance of a Session using this client and the given refreshToken.
 func (client *Client) NewSession(refreshToken string) (*Session, error) {
 	session, err := NewSession(client, refreshToken)
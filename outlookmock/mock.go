@@ -0,0 +1,235 @@
+// Package outlookmock provides a mock implementation of go-outlook's SessionAPI, which records the requests made through it and answers them
+// with configured results, so application code can be tested without any http at all.
+package outlookmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	outlook "github.com/amhester/go-outlook"
+)
+
+var (
+	// ErrUnexpectedCall is returned for requests which no response was configured for.
+	ErrUnexpectedCall = fmt.Errorf("no response configured for the request")
+)
+
+// Call a request made through a Requester. Path is relative to the session's mailbox, e.g. /calendars/{id}.
+type Call struct {
+	Method string
+	Path   string
+	Params url.Values
+	Header http.Header
+	Body   interface{}
+}
+
+// Response a configured answer to a request.
+type Response struct {
+	// Result the value decoded into the call's result. It can be a value of the result's type, such as an *outlook.Calendar, or raw json.
+	Result interface{}
+	// Err the error the call fails with.
+	Err error
+	// StatusCode the http status of the response. Defaults to 200, or 204 when there is no result.
+	StatusCode int
+}
+
+// Requester an outlook.Requester which records every request and answers each with the responses configured for its method and path.
+type Requester struct {
+	mu        sync.Mutex
+	calls     []*Call
+	responses map[string][]*Response
+}
+
+// NewRequester returns a new instance of a Requester with no responses configured.
+func NewRequester() *Requester {
+	return &Requester{
+		responses: map[string][]*Response{},
+	}
+}
+
+// On configures the responses for requests with the given method and path, which are used in order with the last repeated once the others have run out.
+func (r *Requester) On(method, path string, responses ...*Response) *Requester {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := responseKey(method, path)
+	r.responses[key] = append(r.responses[key], responses...)
+	return r
+}
+
+// OnResult configures a single successful response with the given result for requests with the given method and path.
+func (r *Requester) OnResult(method, path string, result interface{}) *Requester {
+	return r.On(method, path, &Response{Result: result})
+}
+
+// OnError configures a single failed response for requests with the given method and path.
+func (r *Requester) OnError(method, path string, err error) *Requester {
+	return r.On(method, path, &Response{Err: err})
+}
+
+// Calls returns every request made so far.
+func (r *Requester) Calls() []*Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Call(nil), r.calls...)
+}
+
+// CallsTo returns the requests made so far with the given method and path.
+func (r *Requester) CallsTo(method, path string) []*Call {
+	var calls []*Call
+	for _, call := range r.Calls() {
+		if call.Method == method && call.Path == path {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets every request made and response configured so far.
+func (r *Requester) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+	r.responses = map[string][]*Response{}
+}
+
+// Get records a get request and answers it.
+func (r *Requester) Get(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodGet, url, queryValues(params), nil, nil, result)
+}
+
+// Post records a post request and answers it.
+func (r *Requester) Post(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodPost, url, nil, nil, data, result)
+}
+
+// Patch records a patch request and answers it.
+func (r *Requester) Patch(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodPatch, url, nil, nil, data, result)
+}
+
+// Delete records a delete request and answers it.
+func (r *Requester) Delete(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return r.Query(ctx, http.MethodDelete, url, queryValues(params), nil, nil, result)
+}
+
+// Query records a request of any method, along with the headers the call set such as If-Match, and answers it.
+func (r *Requester) Query(ctx context.Context, method, url string, params url.Values, header http.Header, data interface{}, result interface{}) (*http.Response, error) {
+	return r.respond(&Call{Method: method, Path: url, Params: params, Header: header, Body: data}, result)
+}
+
+func (r *Requester) respond(call *Call, result interface{}) (*http.Response, error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	key := responseKey(call.Method, call.Path)
+	var response *Response
+	if queued := r.responses[key]; len(queued) > 0 {
+		response = queued[0]
+		if len(queued) > 1 {
+			r.responses[key] = queued[1:]
+		}
+	}
+	r.mu.Unlock()
+
+	if response == nil {
+		return nil, fmt.Errorf("%v: %s", ErrUnexpectedCall, key)
+	}
+	if response.Err != nil {
+		return nil, response.Err
+	}
+
+	status := response.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+		if response.Result == nil {
+			status = http.StatusNoContent
+		}
+	}
+	if response.Result != nil && result != nil {
+		if err := decodeResult(response.Result, result); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Response{StatusCode: status, Header: http.Header{}}, nil
+}
+
+// decodeResult copies a configured result into the call's result through json, so any value with the same json shape can be configured.
+func decodeResult(configured, result interface{}) error {
+	var data []byte
+	switch v := configured.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, result)
+}
+
+// queryValues converts the query parameters given to Get and Delete into the url.Values calls are recorded with.
+func queryValues(params map[string]interface{}) url.Values {
+	if params == nil {
+		return nil
+	}
+	values := url.Values{}
+	for key, val := range params {
+		values.Set(key, fmt.Sprintf("%v", val))
+	}
+	return values
+}
+
+func responseKey(method, path string) string {
+	return fmt.Sprintf("%s %s", method, path)
+}
+
+// Session an outlook.SessionAPI backed by a mock Requester. The services, batches and ForUser copies it hands out are those of an
+// outlook.Session, so every call reaches the Requester; ForUser copies send their paths prefixed with /users/{id}.
+type Session struct {
+	*outlook.Session
+	*Requester
+}
+
+// NewSession returns a new instance of a Session with no responses configured.
+func NewSession() *Session {
+	requester := NewRequester()
+	return &Session{
+		Session:   outlook.NewRequesterSession(requester),
+		Requester: requester,
+	}
+}
+
+// Get records a get request and answers it.
+func (session *Session) Get(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return session.Session.Get(ctx, url, params, result)
+}
+
+// Post records a post request and answers it.
+func (session *Session) Post(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return session.Session.Post(ctx, url, data, result)
+}
+
+// Patch records a patch request and answers it.
+func (session *Session) Patch(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
+	return session.Session.Patch(ctx, url, data, result)
+}
+
+// Delete records a delete request and answers it.
+func (session *Session) Delete(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
+	return session.Session.Delete(ctx, url, params, result)
+}
+
+// Query records a request of any method and answers it.
+func (session *Session) Query(ctx context.Context, method, url string, params url.Values, header http.Header, data interface{}, result interface{}) (*http.Response, error) {
+	return session.Session.Query(ctx, method, url, params, header, data, result)
+}
+
+var _ outlook.SessionAPI = (*Session)(nil)
@@ -0,0 +1,60 @@
+package outlookmock
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	outlook "github.com/amhester/go-outlook"
+)
+
+func TestSessionForUserPrefixesPaths(t *testing.T) {
+	session := NewSession()
+	session.OnResult(http.MethodGet, "/calendars/work", &outlook.Calendar{ID: "work"})
+	session.OnResult(http.MethodGet, "/users/ann@contoso.com/calendars/work", &outlook.Calendar{ID: "shared"})
+	ctx := context.Background()
+
+	own, err := session.Calendars().Get("work").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := session.ForUser("ann@contoso.com").Calendars().Get("work").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.ID != "work" || shared.ID != "shared" {
+		t.Errorf("got calendars %q and %q, want work and shared", own.ID, shared.ID)
+	}
+	if got := session.ForUser("Ann@contoso.com").Mailbox(); got != "ann@contoso.com" {
+		t.Errorf("Mailbox() = %q, want ann@contoso.com", got)
+	}
+}
+
+func TestSessionBatchRunsEachItem(t *testing.T) {
+	session := NewSession()
+	session.OnResult(http.MethodPost, "/calendars", &outlook.Calendar{ID: "new"})
+	session.OnError(http.MethodGet, "/calendars/missing", &outlook.ErrStatusCode{Code: http.StatusNotFound})
+	ctx := context.Background()
+
+	batch := session.Batch()
+	created := batch.Add(session.Calendars().Create().Calendar(&outlook.Calendar{Name: "New"}))
+	missing := batch.Add(session.Calendars().Get("missing"))
+	dependent := batch.Add(session.Calendars().Delete("missing")).DependsOn(missing)
+	if err := batch.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := outlook.BatchResult[*outlook.Calendar](created)
+	if err != nil || calendar.ID != "new" {
+		t.Errorf("created item got %+v, %v, want the new calendar", calendar, err)
+	}
+	if missing.Status() != http.StatusNotFound {
+		t.Errorf("missing item has status %d, want 404", missing.Status())
+	}
+	if dependent.Status() != http.StatusFailedDependency {
+		t.Errorf("dependent item has status %d, want 424", dependent.Status())
+	}
+	if calls := session.CallsTo(http.MethodDelete, "/calendars/missing"); len(calls) != 0 {
+		t.Errorf("dependent item was sent %d times, want never", len(calls))
+	}
+}
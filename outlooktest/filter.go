@@ -0,0 +1,497 @@
+package outlooktest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filter a parsed $filter expression, evaluated against a stored object with the values of any lambda variables in scope.
+type filter func(obj object, vars map[string]interface{}) bool
+
+// parseFilter parses the subset of OData $filter expressions the odata package builds: comparisons, in, and, or, not,
+// startswith, endswith, contains, and any or all over collections.
+func parseFilter(expression string) (filter, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '\'':
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(expression) {
+					return nil, fmt.Errorf("unterminated string literal")
+				}
+				if expression[i] == '\'' {
+					if i+1 < len(expression) && expression[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(expression[i])
+				i++
+			}
+			tokens = append(tokens, token{text: sb.String(), quoted: true})
+		default:
+			start := i
+			for i < len(expression) && !strings.ContainsRune(" (),'", rune(expression[i])) {
+				i++
+			}
+			tokens = append(tokens, token{text: expression[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) next() (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) expect(text string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.quoted || t.text != text {
+		return fmt.Errorf("expected '%s' but found '%s'", text, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) keyword(text string) bool {
+	if t, ok := p.peek(); ok && !t.quoted && strings.EqualFold(t.text, text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(obj object, vars map[string]interface{}) bool { return l(obj, vars) || right(obj, vars) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(obj object, vars map[string]interface{}) bool { return l(obj, vars) && right(obj, vars) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (filter, error) {
+	if p.keyword("not") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(obj object, vars map[string]interface{}) bool { return !f(obj, vars) }, nil
+	}
+	return p.primary()
+}
+
+func (p *filterParser) primary() (filter, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.quoted {
+		return nil, fmt.Errorf("unexpected literal '%s'", t.text)
+	}
+	if t.text == "(" {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+
+	switch fn := strings.ToLower(t.text); fn {
+	case "startswith", "endswith", "contains":
+		return p.stringFunction(fn)
+	}
+	if i := strings.LastIndex(t.text, "/"); i > 0 {
+		switch lambda := strings.ToLower(t.text[i+1:]); lambda {
+		case "any", "all":
+			return p.lambda(t.text[:i], lambda)
+		}
+	}
+
+	path := t.text
+	opToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(opToken.text)
+	if op == "in" {
+		values, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return func(obj object, vars map[string]interface{}) bool {
+			value := resolve(obj, vars, path)
+			for _, literal := range values {
+				if compare(value, literal) == 0 {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	literal, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	var test func(int) bool
+	switch op {
+	case "eq":
+		test = func(c int) bool { return c == 0 }
+	case "ne":
+		test = func(c int) bool { return c != 0 }
+	case "gt":
+		test = func(c int) bool { return c == 1 }
+	case "ge":
+		test = func(c int) bool { return c == 0 || c == 1 }
+	case "lt":
+		test = func(c int) bool { return c == -1 }
+	case "le":
+		test = func(c int) bool { return c == -1 || c == 0 }
+	default:
+		return nil, fmt.Errorf("unsupported operator '%s'", opToken.text)
+	}
+	return func(obj object, vars map[string]interface{}) bool {
+		return test(compare(resolve(obj, vars, path), literal))
+	}, nil
+}
+
+func (p *filterParser) stringFunction(fn string) (filter, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	pathToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	arg, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	var test func(string, string) bool
+	switch fn {
+	case "startswith":
+		test = strings.HasPrefix
+	case "endswith":
+		test = strings.HasSuffix
+	default:
+		test = strings.Contains
+	}
+	return func(obj object, vars map[string]interface{}) bool {
+		value, _ := resolve(obj, vars, pathToken.text).(string)
+		return test(strings.ToLower(value), strings.ToLower(arg.text))
+	}, nil
+}
+
+func (p *filterParser) lambda(path, kind string) (filter, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	// The lambda's variable and the start of its body are read as a single word, e.g. x:x/emailAddress/address
+	parts := strings.SplitN(t.text, ":", 2)
+	if len(parts) != 2 || t.quoted {
+		return nil, fmt.Errorf("expected a lambda variable but found '%s'", t.text)
+	}
+	variable := parts[0]
+	// A body starting with a parenthesis leaves nothing after the colon
+	if parts[1] != "" {
+		p.tokens[p.pos-1] = token{text: parts[1]}
+		p.pos--
+	}
+	body, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return func(obj object, vars map[string]interface{}) bool {
+		items, _ := resolve(obj, vars, path).([]interface{})
+		scope := map[string]interface{}{}
+		for key, value := range vars {
+			scope[key] = value
+		}
+		for _, item := range items {
+			scope[variable] = item
+			if body(obj, scope) != (kind == "all") {
+				return kind == "any"
+			}
+		}
+		return kind == "all"
+	}, nil
+}
+
+func (p *filterParser) list() ([]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for {
+		literal, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, literal)
+		t, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == ")" && !t.quoted {
+			return values, nil
+		}
+		if t.text != "," || t.quoted {
+			return nil, fmt.Errorf("expected ',' but found '%s'", t.text)
+		}
+	}
+}
+
+// literal parses an OData literal into a string, float64, bool, time.Time or nil.
+func (p *filterParser) literal() (interface{}, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.quoted {
+		return t.text, nil
+	}
+	switch t.text {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+		return n, nil
+	}
+	if tm, err := time.Parse(time.RFC3339Nano, t.text); err == nil {
+		return tm, nil
+	}
+	return nil, fmt.Errorf("invalid literal '%s'", t.text)
+}
+
+// resolve returns the value at path, which starts either at obj or at a lambda variable.
+func resolve(obj object, vars map[string]interface{}, path string) interface{} {
+	segments := strings.Split(path, "/")
+	var current interface{} = map[string]interface{}(obj)
+	if value, ok := vars[segments[0]]; ok {
+		current, segments = value, segments[1:]
+	}
+	for _, segment := range segments {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			if o, isObject := current.(object); isObject {
+				m = o
+			} else {
+				return nil
+			}
+		}
+		current = m[segment]
+	}
+	return current
+}
+
+// incomparable the result of comparing values of different types, which only ne treats as a match.
+const incomparable = -2
+
+// compare returns the ordering of a stored value against a literal, as -1, 0 or 1, or incomparable.
+func compare(value, literal interface{}) int {
+	switch l := literal.(type) {
+	case nil:
+		if value == nil {
+			return 0
+		}
+		return incomparable
+	case bool:
+		v, ok := value.(bool)
+		if value == nil {
+			v, ok = false, true
+		}
+		if !ok {
+			return incomparable
+		}
+		if v == l {
+			return 0
+		}
+		return incomparable
+	case float64:
+		v, ok := value.(float64)
+		if !ok {
+			return incomparable
+		}
+		return compareOrdered(v < l, v > l)
+	case time.Time:
+		s, _ := value.(string)
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return incomparable
+		}
+		return compareOrdered(v.Before(l), v.After(l))
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return incomparable
+		}
+		v, l = strings.ToLower(v), strings.ToLower(l)
+		return compareOrdered(v < l, v > l)
+	}
+	return incomparable
+}
+
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// sortObjects orders objs by an $orderby parameter such as receivedDateTime desc,subject.
+func sortObjects(objs []object, orderBy string) []object {
+	type clause struct {
+		path string
+		desc bool
+	}
+	var clauses []clause
+	for _, part := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		clauses = append(clauses, clause{path: fields[0], desc: len(fields) > 1 && strings.EqualFold(fields[1], "desc")})
+	}
+
+	sorted := append([]object(nil), objs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		for _, c := range clauses {
+			a := resolve(sorted[i], nil, c.path)
+			b := resolve(sorted[j], nil, c.path)
+			cmp := compareValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if c.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return sorted
+}
+
+// compareValues orders two stored values of the same type, with missing values first.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch av := a.(type) {
+	case float64:
+		if bv, ok := b.(float64); ok {
+			return compareOrdered(av < bv, av > bv)
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			return compareOrdered(!av && bv, av && !bv)
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return compareOrdered(av < bv, av > bv)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package outlooktest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/amhester/go-outlook/odata"
+)
+
+// testObjects decodes the JSON of stored objects, as the server holds them.
+func testObjects(t *testing.T, raw ...string) []object {
+	t.Helper()
+	objs := make([]object, len(raw))
+	for i, r := range raw {
+		if err := json.Unmarshal([]byte(r), &objs[i]); err != nil {
+			t.Fatalf("decoding %s: %v", r, err)
+		}
+	}
+	return objs
+}
+
+func TestParseFilter(t *testing.T) {
+	objs := testObjects(t, `{
+		"subject": "Weekly report",
+		"importance": "high",
+		"isRead": false,
+		"size": 2048,
+		"receivedDateTime": "2024-01-31T09:30:00Z",
+		"from": {"emailAddress": {"name": "Ann Lee", "address": "ann@contoso.com"}},
+		"toRecipients": [
+			{"emailAddress": {"address": "bob@contoso.com"}},
+			{"emailAddress": {"address": "carol@fabrikam.com"}}
+		],
+		"categories": ["Blue", "Red"],
+		"attendees": [
+			{"emailAddress": {"address": "bob@contoso.com"}, "proposals": [{"status": "accepted"}, {"status": "declined"}]}
+		]
+	}`)
+	obj := objs[0]
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"subject eq 'Weekly report'", true},
+		{"subject eq 'weekly REPORT'", true},
+		{"subject ne 'Weekly report'", false},
+		{"subject eq 'it''s'", false},
+		{"importance in ('low', 'high')", true},
+		{"importance in ('low', 'normal')", false},
+		{"isRead eq false", true},
+		{"isRead eq true", false},
+		{"size gt 1024", true},
+		{"size le 1024", false},
+		{"size ge 2048 and size lt 4096", true},
+		{"flag eq null", true},
+		{"subject ne null", true},
+		{"receivedDateTime ge 2024-01-31T00:00:00Z", true},
+		{"receivedDateTime lt 2024-01-31T00:00:00Z", false},
+		{"from/emailAddress/address eq 'ann@contoso.com'", true},
+		{"startswith(subject, 'weekly')", true},
+		{"endswith(from/emailAddress/address, '@contoso.com')", true},
+		{"contains(subject, 'port')", true},
+		{"contains(subject, 'missing')", false},
+		{"not contains(subject, 'missing')", true},
+		{"subject eq 'x' or importance eq 'high'", true},
+		{"(subject eq 'x' or importance eq 'high') and isRead eq true", false},
+		{"toRecipients/any(r:r/emailAddress/address eq 'bob@contoso.com')", true},
+		{"toRecipients/any(r:r/emailAddress/address eq 'dave@contoso.com')", false},
+		{"toRecipients/all(r:endswith(r/emailAddress/address, '.com'))", true},
+		{"toRecipients/all(r:endswith(r/emailAddress/address, '@contoso.com'))", false},
+		{"categories/any(c:c eq 'red')", true},
+		{"attendees/any(a:a/proposals/any(p:p/status eq 'declined'))", true},
+		{"attendees/any(a:a/proposals/all(p:p/status eq 'accepted'))", false},
+		{"attendees/any(x1:x1/proposals/any(x:x/status eq 'accepted' and x1/emailAddress/address eq 'bob@contoso.com'))", true},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		if got := f(obj, nil); got != tt.want {
+			t.Errorf("parseFilter(%q) matched %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterBuiltExpressions(t *testing.T) {
+	objs := testObjects(t, `{
+		"attendees": [
+			{"emailAddress": {"address": "bob@contoso.com"}, "proposals": [{"status": "accepted"}]},
+			{"emailAddress": {"address": "carol@contoso.com"}, "proposals": [{"status": "declined"}]}
+		]
+	}`)
+	attendees := odata.Field("attendees")
+
+	tests := []struct {
+		filter odata.Expr
+		want   bool
+	}{
+		{attendees.Any(func(a odata.Field) odata.Expr {
+			return a.Path("proposals").Any(func(p odata.Field) odata.Expr {
+				return odata.And(p.Path("status").Eq("declined"), a.Path("emailAddress/address").Eq("carol@contoso.com"))
+			})
+		}), true},
+		{attendees.Any(func(a odata.Field) odata.Expr {
+			return a.Path("proposals").Any(func(p odata.Field) odata.Expr {
+				return odata.And(p.Path("status").Eq("declined"), a.Path("emailAddress/address").Eq("bob@contoso.com"))
+			})
+		}), false},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.filter.String())
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.filter, err)
+			continue
+		}
+		if got := f(objs[0], nil); got != tt.want {
+			t.Errorf("parseFilter(%q) matched %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"subject eq",
+		"subject eq 'unterminated",
+		"subject like 'x'",
+		"subject eq 'x' and",
+		"(subject eq 'x'",
+		"subject eq 'x')",
+		"importance in ('low' 'high')",
+		"toRecipients/any(r/emailAddress/address eq 'x')",
+		"size gt twelve",
+		"'literal' eq subject",
+	} {
+		if _, err := parseFilter(filter); err == nil {
+			t.Errorf("parseFilter(%q) succeeded, want an error", filter)
+		}
+	}
+}
+
+func TestSortObjects(t *testing.T) {
+	objs := testObjects(t,
+		`{"id": "a", "importance": "low", "receivedDateTime": "2024-01-02T00:00:00Z", "size": 10}`,
+		`{"id": "b", "importance": "high", "receivedDateTime": "2024-01-03T00:00:00Z", "size": 5}`,
+		`{"id": "c", "importance": "high", "receivedDateTime": "2024-01-01T00:00:00Z"}`,
+	)
+
+	tests := []struct {
+		orderBy string
+		want    string
+	}{
+		{"receivedDateTime", "cab"},
+		{"receivedDateTime desc", "bac"},
+		{"size", "cba"},
+		{"size desc", "abc"},
+		{"importance,receivedDateTime desc", "bca"},
+		{"importance desc, receivedDateTime", "acb"},
+		{"", "abc"},
+	}
+	for _, tt := range tests {
+		var got string
+		for _, obj := range sortObjects(objs, tt.orderBy) {
+			got += obj.string("id")
+		}
+		if got != tt.want {
+			t.Errorf("sortObjects(%q) = %s, want %s", tt.orderBy, got, tt.want)
+		}
+	}
+}
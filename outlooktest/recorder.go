@@ -0,0 +1,268 @@
+// Package outlooktest provides tools for testing code built on go-outlook without reaching microsoft's graph api,
+// by recording real interactions to golden files and replaying them back.
+package outlooktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	outlook "github.com/amhester/go-outlook"
+)
+
+const (
+	// Redacted the value recorded in place of credentials.
+	Redacted = "REDACTED"
+
+	// EnvMode the environment variable read by ModeFromEnv.
+	EnvMode = "OUTLOOK_TEST_MODE"
+)
+
+// Mode whether a golden file is being recorded from real traffic or replayed.
+type Mode string
+
+// Modes a golden file can be used in.
+const (
+	ModeReplay Mode = "replay"
+	ModeRecord Mode = "record"
+)
+
+// ModeFromEnv returns ModeRecord when OUTLOOK_TEST_MODE is set to record, and ModeReplay otherwise, so that ci never reaches the real api.
+func ModeFromEnv() Mode {
+	if Mode(strings.ToLower(os.Getenv(EnvMode))) == ModeRecord {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+var (
+	// redactedFormFields the fields of form encoded request bodies which hold credentials.
+	redactedFormFields = []string{
+		"client_secret",
+		"client_assertion",
+		"refresh_token",
+		"code",
+		"code_verifier",
+		"assertion",
+		"device_code",
+		"password",
+	}
+	// redactedJSONFields the fields of json response bodies which hold credentials.
+	redactedJSONFields = []string{
+		"access_token",
+		"refresh_token",
+		"id_token",
+		"device_code",
+	}
+	// redactedHeaders the headers which hold credentials.
+	redactedHeaders = []string{
+		"Authorization",
+		"Cookie",
+		"Set-Cookie",
+	}
+)
+
+// Interaction a single recorded request and the response it got.
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest the recorded form of an http request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse the recorded form of an http response.
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder an http.RoundTripper which sends requests on to a real transport and records every interaction, with bearer tokens and secrets redacted.
+// It can be given to a client with outlook.SetClientHTTPClient, or added to one with outlook.SetClientMiddleware(recorder.Middleware).
+type Recorder struct {
+	mu           sync.Mutex
+	path         string
+	transport    http.RoundTripper
+	interactions []*Interaction
+}
+
+// NewRecorder returns a new instance of a Recorder which saves to the golden file at path, sending requests through transport or http.DefaultTransport if nil.
+func NewRecorder(path string, transport http.RoundTripper) *Recorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Recorder{
+		path:      path,
+		transport: transport,
+	}
+}
+
+// Middleware returns a RoundTripper which records into the recorder, sharing its interactions, but sends requests on to next rather
+// than the recorder's transport, for use as an outlook.Middleware.
+func (rec *Recorder) Middleware(next http.RoundTripper) http.RoundTripper {
+	return outlook.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return rec.record(req, next)
+	})
+}
+
+// RoundTrip sends req through the recorder's transport and records the interaction.
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rec.record(req, rec.transport)
+}
+
+func (rec *Recorder) record(req *http.Request, transport http.RoundTripper) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := readBody(&res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: &RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: redactHeader(req.Header),
+			Body:   redactRequestBody(req.Header.Get("Content-Type"), reqBody),
+		},
+		Response: &RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     redactHeader(res.Header),
+			Body:       redactResponseBody(resBody),
+		},
+	}
+	rec.mu.Lock()
+	rec.interactions = append(rec.interactions, interaction)
+	rec.mu.Unlock()
+
+	return res, nil
+}
+
+// Interactions returns the interactions recorded so far.
+func (rec *Recorder) Interactions() []*Interaction {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]*Interaction(nil), rec.interactions...)
+}
+
+// Save writes the interactions recorded so far to the recorder's golden file.
+func (rec *Recorder) Save() error {
+	data, err := json.MarshalIndent(rec.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(rec.path, append(data, '\n'), 0644)
+}
+
+// LoadInteractions reads the interactions saved in the golden file at path.
+func LoadInteractions(path string) ([]*Interaction, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []*Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("invalid golden file %s: %v", path, err)
+	}
+	return interactions, nil
+}
+
+// readBody reads the body behind the given pointer and replaces it with an unread copy.
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	if err != nil {
+		return "", err
+	}
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, key := range redactedHeaders {
+		values := redacted.Values(key)
+		for i, value := range values {
+			if strings.HasPrefix(value, "Bearer ") {
+				values[i] = "Bearer " + Redacted
+			} else {
+				values[i] = Redacted
+			}
+		}
+	}
+	return redacted
+}
+
+func redactRequestBody(contentType, body string) string {
+	if body == "" || !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return body
+	}
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return body
+	}
+	for _, field := range redactedFormFields {
+		if _, ok := form[field]; ok {
+			form.Set(field, Redacted)
+		}
+	}
+	return form.Encode()
+}
+
+func redactResponseBody(body string) string {
+	var fields map[string]json.RawMessage
+	if body == "" || json.Unmarshal([]byte(body), &fields) != nil {
+		return body
+	}
+	redacted := false
+	for _, field := range redactedJSONFields {
+		if _, ok := fields[field]; ok {
+			fields[field] = json.RawMessage(`"` + Redacted + `"`)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return body
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+// NewTransport returns a Recorder or Replayer for the golden file at path depending on mode, along with a function which saves the recording
+// and does nothing when replaying. When recording, requests are sent through transport or http.DefaultTransport if nil.
+func NewTransport(path string, mode Mode, transport http.RoundTripper, opts ...ReplayOpt) (http.RoundTripper, func() error, error) {
+	if mode == ModeRecord {
+		rec := NewRecorder(path, transport)
+		return rec, rec.Save, nil
+	}
+	replayer, err := NewReplayer(path, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return replayer, func() error { return nil }, nil
+}
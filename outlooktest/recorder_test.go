@@ -0,0 +1,121 @@
+package outlooktest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorderRedactsCredentials(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"issued-access","refresh_token":"issued-refresh","expires_in":3600}`))
+	}))
+	defer upstream.Close()
+
+	rec := NewRecorder(filepath.Join(t.TempDir(), "golden.json"), nil)
+	form := url.Values{"grant_type": {"refresh_token"}, "client_secret": {"app-secret"}, "refresh_token": {"old-refresh"}}
+	req, _ := http.NewRequest(http.MethodPost, upstream.URL+"/common/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer user-token")
+	res, err := rec.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller still reads the real response
+	body, _ := ioutil.ReadAll(res.Body)
+	if !strings.Contains(string(body), "issued-access") {
+		t.Errorf("caller got body %s, want the unredacted response", body)
+	}
+
+	interactions := rec.Interactions()
+	if len(interactions) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(interactions))
+	}
+	recorded := interactions[0]
+	if got := recorded.Request.Header.Get("Authorization"); got != "Bearer "+Redacted {
+		t.Errorf("recorded Authorization %q", got)
+	}
+	if got := recorded.Response.Header.Get("Set-Cookie"); got != Redacted {
+		t.Errorf("recorded Set-Cookie %q", got)
+	}
+	recordedForm, _ := url.ParseQuery(recorded.Request.Body)
+	if recordedForm.Get("client_secret") != Redacted || recordedForm.Get("refresh_token") != Redacted || recordedForm.Get("grant_type") != "refresh_token" {
+		t.Errorf("recorded request body %s", recorded.Request.Body)
+	}
+	for _, secret := range []string{"issued-access", "issued-refresh", "app-secret", "old-refresh", "user-token"} {
+		if strings.Contains(recorded.Request.Body+recorded.Response.Body, secret) {
+			t.Errorf("recording holds %s", secret)
+		}
+	}
+	if !strings.Contains(recorded.Response.Body, `"expires_in":3600`) {
+		t.Errorf("recorded response body %s lost its other fields", recorded.Response.Body)
+	}
+}
+
+func TestRecorderSaveAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer upstream.Close()
+
+	path := filepath.Join(t.TempDir(), "golden.json")
+	rec := NewRecorder(path, nil)
+	client := &http.Client{Transport: rec.Middleware(http.DefaultTransport)}
+	for _, p := range []string{"/v1.0/me/calendars", "/v1.0/me/events"} {
+		res, err := client.Post(upstream.URL+p, "application/json", strings.NewReader(`{"name":"x"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	transport, save, err := NewTransport(path, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer save()
+	replayed := &http.Client{Transport: transport}
+	// The host differs from the one recorded, which replaying ignores
+	res, err := replayed.Post("https://graph.microsoft.com/v1.0/me/calendars", "application/json", strings.NewReader(`{"name":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusCreated || string(body) != "{\"path\":\"/v1.0/me/calendars\"}" {
+		t.Errorf("replayed %d %s", res.StatusCode, body)
+	}
+	if remaining := transport.(*Replayer).Remaining(); remaining != 1 {
+		t.Errorf("%d interactions remaining, want 1", remaining)
+	}
+}
+
+func TestModeFromEnv(t *testing.T) {
+	for value, want := range map[string]Mode{"": ModeReplay, "replay": ModeReplay, "record": ModeRecord, "RECORD": ModeRecord, "other": ModeReplay} {
+		t.Setenv(EnvMode, value)
+		if got := ModeFromEnv(); got != want {
+			t.Errorf("ModeFromEnv() with %q = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestLoadInteractionsRejectsInvalidFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.json")
+	ioutil.WriteFile(path, []byte("not json"), 0644)
+	if _, err := LoadInteractions(path); err == nil {
+		t.Error("LoadInteractions succeeded on an invalid file")
+	}
+	if _, err := NewReplayer(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("NewReplayer succeeded without a golden file")
+	}
+}
@@ -0,0 +1,178 @@
+package outlooktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+var (
+	// ErrNoInteraction is returned when a replayer has no recorded interaction left which matches a request.
+	ErrNoInteraction = fmt.Errorf("no recorded interaction matches the request")
+)
+
+// Matcher reports whether a recorded request matches a request being replayed, whose body has already been read.
+type Matcher func(req *http.Request, body string, recorded *RecordedRequest) bool
+
+// MatchMethod a Matcher comparing request methods.
+func MatchMethod(req *http.Request, body string, recorded *RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchPath a Matcher comparing url paths, ignoring the host so recordings can be replayed against any server.
+func MatchPath(req *http.Request, body string, recorded *RecordedRequest) bool {
+	u, err := url.Parse(recorded.URL)
+	return err == nil && u.Path == req.URL.Path
+}
+
+// MatchQuery a Matcher comparing query parameters, ignoring their order.
+func MatchQuery(req *http.Request, body string, recorded *RecordedRequest) bool {
+	u, err := url.Parse(recorded.URL)
+	return err == nil && u.Query().Encode() == req.URL.Query().Encode()
+}
+
+// MatchBody a Matcher comparing request bodies, as json when both are json and ignoring credentials which were redacted when recording.
+func MatchBody(req *http.Request, body string, recorded *RecordedRequest) bool {
+	body = redactRequestBody(req.Header.Get("Content-Type"), body)
+	var a, b interface{}
+	if json.Unmarshal([]byte(body), &a) == nil && json.Unmarshal([]byte(recorded.Body), &b) == nil {
+		aj, _ := json.Marshal(a)
+		bj, _ := json.Marshal(b)
+		return bytes.Equal(aj, bj)
+	}
+	return body == recorded.Body
+}
+
+// DefaultMatchers the matchers a Replayer uses unless others are given.
+var DefaultMatchers = []Matcher{MatchMethod, MatchPath, MatchQuery}
+
+// ReplayOpt function used to configure a Replayer.
+type ReplayOpt func(*Replayer)
+
+// ReplayInOrder returns a ReplayOpt function which makes the replayer serve interactions strictly in the order they were recorded,
+// failing any request which doesn't match the next one. This is the default.
+func ReplayInOrder() ReplayOpt {
+	return func(r *Replayer) {
+		r.inOrder = true
+	}
+}
+
+// ReplayAnyOrder returns a ReplayOpt function which makes the replayer serve the first unused interaction matching each request, for callers which make concurrent requests.
+func ReplayAnyOrder() ReplayOpt {
+	return func(r *Replayer) {
+		r.inOrder = false
+	}
+}
+
+// ReplayMatching returns a ReplayOpt function which sets the matchers a recorded interaction must satisfy to be served for a request.
+func ReplayMatching(matchers ...Matcher) ReplayOpt {
+	return func(r *Replayer) {
+		r.matchers = matchers
+	}
+}
+
+// Replayer an http.RoundTripper which serves interactions saved by a Recorder instead of sending requests anywhere.
+// It can be given to a client with outlook.SetClientHTTPClient(replayer.Client()).
+type Replayer struct {
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	matchers     []Matcher
+	inOrder      bool
+}
+
+// NewReplayer returns a new instance of a Replayer serving the interactions saved in the golden file at path.
+func NewReplayer(path string, opts ...ReplayOpt) (*Replayer, error) {
+	interactions, err := LoadInteractions(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayerFromInteractions(interactions, opts...), nil
+}
+
+// NewReplayerFromInteractions returns a new instance of a Replayer serving the given interactions.
+func NewReplayerFromInteractions(interactions []*Interaction, opts ...ReplayOpt) *Replayer {
+	r := &Replayer{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+		matchers:     DefaultMatchers,
+		inOrder:      true,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Client returns an http client which sends its requests to the replayer.
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip serves the recorded response of the interaction matching req, or fails with ErrNoInteraction.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] {
+			continue
+		}
+		if r.matches(req, body, interaction.Request) {
+			r.used[i] = true
+			return replayResponse(req, interaction.Response), nil
+		}
+		if r.inOrder {
+			break
+		}
+	}
+	return nil, fmt.Errorf("%v: %s %s", ErrNoInteraction, req.Method, req.URL)
+}
+
+// Remaining returns the number of recorded interactions which have not been served, so tests can check every expected request was made.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for _, used := range r.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (r *Replayer) matches(req *http.Request, body string, recorded *RecordedRequest) bool {
+	for _, matcher := range r.matchers {
+		if !matcher(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func replayResponse(req *http.Request, recorded *RecordedResponse) *http.Response {
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(recorded.Body))),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
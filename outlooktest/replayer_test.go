@@ -0,0 +1,113 @@
+package outlooktest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testInteractions returns interactions answering each of the given requests, written as "METHOD url", with a body naming the request.
+func testInteractions(requests ...string) []*Interaction {
+	var interactions []*Interaction
+	for _, r := range requests {
+		parts := strings.SplitN(r, " ", 2)
+		interactions = append(interactions, &Interaction{
+			Request:  &RecordedRequest{Method: parts[0], URL: parts[1]},
+			Response: &RecordedResponse{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/json"}}, Body: `"` + r + `"`},
+		})
+	}
+	return interactions
+}
+
+// replay sends a request through r, returning the body of the response.
+func replay(r *Replayer, method, rawURL, body string) (string, error) {
+	req, _ := http.NewRequest(method, rawURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	return string(data), nil
+}
+
+func TestReplayerInOrder(t *testing.T) {
+	r := NewReplayerFromInteractions(testInteractions(
+		"GET https://graph.microsoft.com/v1.0/me/calendars?$top=10&$count=true",
+		"GET https://graph.microsoft.com/v1.0/me/events",
+	))
+
+	// Only the next interaction can be served, so the second request can't go first
+	if _, err := replay(r, http.MethodGet, "http://localhost/v1.0/me/events", ""); err == nil || !strings.Contains(err.Error(), ErrNoInteraction.Error()) {
+		t.Errorf("out of order request got %v, want ErrNoInteraction", err)
+	}
+	// Query parameters match in any order, and the host is ignored
+	body, err := replay(r, http.MethodGet, "http://localhost/v1.0/me/calendars?$count=true&$top=10", "")
+	if err != nil || !strings.Contains(body, "/calendars") {
+		t.Errorf("first request got %q, %v", body, err)
+	}
+	if _, err := replay(r, http.MethodGet, "http://localhost/v1.0/me/events", ""); err != nil {
+		t.Errorf("second request got %v", err)
+	}
+	if r.Remaining() != 0 {
+		t.Errorf("%d interactions remaining, want none", r.Remaining())
+	}
+	if _, err := replay(r, http.MethodGet, "http://localhost/v1.0/me/events", ""); err == nil {
+		t.Error("a used interaction was served again")
+	}
+}
+
+func TestReplayerAnyOrder(t *testing.T) {
+	r := NewReplayerFromInteractions(testInteractions(
+		"GET https://graph.microsoft.com/v1.0/me/calendars",
+		"DELETE https://graph.microsoft.com/v1.0/me/events/1",
+		"GET https://graph.microsoft.com/v1.0/me/events/1",
+	), ReplayAnyOrder())
+
+	for _, req := range []string{"GET /v1.0/me/events/1", "DELETE /v1.0/me/events/1", "GET /v1.0/me/calendars"} {
+		parts := strings.SplitN(req, " ", 2)
+		body, err := replay(r, parts[0], "http://localhost"+parts[1], "")
+		if err != nil || !strings.Contains(body, parts[0]+" https://graph.microsoft.com"+parts[1]) {
+			t.Errorf("%s got %q, %v", req, body, err)
+		}
+	}
+	if _, err := replay(r, http.MethodGet, "http://localhost/v1.0/me/calendars?$top=5", ""); err == nil {
+		t.Error("a request with different query parameters was served")
+	}
+}
+
+func TestReplayerMatchBody(t *testing.T) {
+	interactions := testInteractions(
+		"POST https://graph.microsoft.com/v1.0/me/calendars",
+		"POST https://graph.microsoft.com/v1.0/me/calendars",
+	)
+	interactions[0].Request.Body = `{"name":"Work","color":"auto"}`
+	interactions[1].Request.Body = `{"name":"Home"}`
+	interactions[1].Response.Body = `"home"`
+	r := NewReplayerFromInteractions(interactions, ReplayAnyOrder(), ReplayMatching(MatchMethod, MatchPath, MatchBody))
+
+	// Bodies are compared as json, so key order and spacing don't matter
+	body, err := replay(r, http.MethodPost, "http://localhost/v1.0/me/calendars", `{ "name": "Home" }`)
+	if err != nil || body != `"home"` {
+		t.Errorf("got %q, %v, want the interaction recorded with the same body", body, err)
+	}
+	if _, err := replay(r, http.MethodPost, "http://localhost/v1.0/me/calendars", `{"color":"auto","name":"Work"}`); err != nil {
+		t.Error(err)
+	}
+	if _, err := replay(r, http.MethodPost, "http://localhost/v1.0/me/calendars", `{"name":"Other"}`); err == nil {
+		t.Error("a request with a different body was served")
+	}
+}
+
+func TestReplayerMatchBodyIgnoresRedactedCredentials(t *testing.T) {
+	interactions := testInteractions("POST https://login.microsoftonline.com/common/oauth2/v2.0/token")
+	interactions[0].Request.Body = "client_secret=" + Redacted + "&grant_type=refresh_token&refresh_token=" + Redacted
+	r := NewReplayerFromInteractions(interactions, ReplayMatching(MatchMethod, MatchPath, MatchBody))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/common/oauth2/v2.0/token", strings.NewReader("grant_type=refresh_token&refresh_token=real&client_secret=real"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := r.RoundTrip(req); err != nil {
+		t.Errorf("token request with real credentials got %v, want the redacted recording", err)
+	}
+}
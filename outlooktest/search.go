@@ -0,0 +1,306 @@
+package outlooktest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// searchDateFormats the formats accepted for the dates of received and sent restrictions.
+var searchDateFormats = []string{"2006-01-02", time.RFC3339, "1/2/2006"}
+
+// searchObjects returns the objs matching the $search parameter, newest first, or the error graph gives for an invalid search.
+// Like graph, it rejects searches combined with $filter, $orderby or $skip.
+func searchObjects(query url.Values, objs []object) ([]object, *response) {
+	for _, param := range []string{"$filter", "$orderby", "$skip"} {
+		if query.Get(param) != "" {
+			return nil, graphError(http.StatusBadRequest, "ErrorInvalidUrlQuery", fmt.Sprintf("The query parameter '%s' is not supported with '$search'.", param))
+		}
+	}
+
+	search := query.Get("$search")
+	if len(search) < 2 || !strings.HasPrefix(search, "\"") || !strings.HasSuffix(search, "\"") {
+		return nil, graphError(http.StatusBadRequest, "BadRequest", "The $search value must be enclosed in double quotes.")
+	}
+	search = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(search[1 : len(search)-1])
+	f, err := parseSearch(search)
+	if err != nil {
+		return nil, graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Syntax error in the search query: %v", err))
+	}
+
+	var matched []object
+	for _, obj := range objs {
+		if f(obj, nil) {
+			matched = append(matched, obj)
+		}
+	}
+	return sortObjects(matched, "receivedDateTime desc"), nil
+}
+
+// parseSearch parses the subset of KQL the kql package builds: free text terms and phrases, property restrictions such as from:ann
+// or received>=2024-01-31, and AND, OR and NOT, with adjacent terms all having to match.
+func parseSearch(query string) (filter, error) {
+	tokens, err := tokenizeSearch(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &searchParser{filterParser{tokens: tokens}}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+// tokenizeSearch splits a KQL query into parentheses and terms. A term which starts with a phrase is quoted, and a phrase
+// following a property restriction, as in subject:"weekly report", is read as part of its term.
+func tokenizeSearch(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		default:
+			var sb strings.Builder
+			quoted := c == '"'
+			for i < len(query) && !strings.ContainsRune(" \t\r\n()", rune(query[i])) {
+				if query[i] != '"' {
+					sb.WriteByte(query[i])
+					i++
+					continue
+				}
+				end := strings.IndexByte(query[i+1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated phrase")
+				}
+				sb.WriteString(query[i+1 : i+1+end])
+				i += end + 2
+			}
+			tokens = append(tokens, token{text: sb.String(), quoted: quoted})
+		}
+	}
+	return tokens, nil
+}
+
+type searchParser struct {
+	filterParser
+}
+
+// operator reports whether the next token is the given KQL operator, which must be upper case, consuming it if so.
+func (p *searchParser) operator(text string) bool {
+	if t, ok := p.peek(); ok && !t.quoted && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *searchParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.operator("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(obj object, vars map[string]interface{}) bool { return l(obj, vars) || right(obj, vars) }
+	}
+	return left, nil
+}
+
+func (p *searchParser) and() (filter, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if !p.operator("AND") {
+			t, ok := p.peek()
+			if !ok || (!t.quoted && (t.text == ")" || t.text == "OR")) {
+				return left, nil
+			}
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(obj object, vars map[string]interface{}) bool { return l(obj, vars) && right(obj, vars) }
+	}
+}
+
+func (p *searchParser) unary() (filter, error) {
+	if p.operator("NOT") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(obj object, vars map[string]interface{}) bool { return !f(obj, vars) }, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if !t.quoted && t.text == "(" {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+	if !t.quoted && t.text == ")" {
+		return nil, fmt.Errorf("unexpected ')'")
+	}
+	return searchTerm(t)
+}
+
+// searchTerm returns the filter for a single term, which is either free text or a restriction on a property.
+func searchTerm(t token) (filter, error) {
+	if t.quoted {
+		return textFilter(t.text, "subject", "bodyPreview", "body/content", "from/emailAddress/name", "from/emailAddress/address"), nil
+	}
+	i := strings.IndexAny(t.text, ":<>=")
+	if i <= 0 {
+		return textFilter(t.text, "subject", "bodyPreview", "body/content", "from/emailAddress/name", "from/emailAddress/address"), nil
+	}
+
+	property := strings.ToLower(t.text[:i])
+	op := t.text[i : i+1]
+	if strings.HasPrefix(t.text[i:], ">=") || strings.HasPrefix(t.text[i:], "<=") {
+		op = t.text[i : i+2]
+	}
+	value := t.text[i+len(op):]
+
+	switch property {
+	case "received", "sent":
+		return dateFilter(property+"DateTime", op, value)
+	}
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("'%s' can't be compared with '%s'", property, op)
+	}
+	switch property {
+	case "from":
+		return textFilter(value, "from/emailAddress/name", "from/emailAddress/address"), nil
+	case "to":
+		return recipientFilter(value, "toRecipients"), nil
+	case "cc":
+		return recipientFilter(value, "ccRecipients"), nil
+	case "bcc":
+		return recipientFilter(value, "bccRecipients"), nil
+	case "participants":
+		from := textFilter(value, "from/emailAddress/name", "from/emailAddress/address")
+		recipients := recipientFilter(value, "toRecipients", "ccRecipients", "bccRecipients")
+		return func(obj object, vars map[string]interface{}) bool { return from(obj, vars) || recipients(obj, vars) }, nil
+	case "subject":
+		return textFilter(value, "subject"), nil
+	case "body":
+		return textFilter(value, "bodyPreview", "body/content"), nil
+	case "attachment":
+		return func(obj object, vars map[string]interface{}) bool {
+			attachments, _ := obj["attachments"].([]interface{})
+			for _, attachment := range attachments {
+				name, _ := resolve(obj, map[string]interface{}{"a": attachment}, "a/name").(string)
+				if containsText(name, value) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "hasattachments":
+		want := strings.EqualFold(value, "true")
+		return func(obj object, vars map[string]interface{}) bool {
+			has, _ := obj["hasAttachments"].(bool)
+			return has == want
+		}, nil
+	}
+	return textFilter(value, t.text[:i]), nil
+}
+
+// textFilter matches objects holding text in any of the given paths.
+func textFilter(text string, paths ...string) filter {
+	return func(obj object, vars map[string]interface{}) bool {
+		for _, path := range paths {
+			value, _ := resolve(obj, vars, path).(string)
+			if containsText(value, text) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// recipientFilter matches objects with a recipient whose name or address holds text in any of the given collections.
+func recipientFilter(text string, collections ...string) filter {
+	return func(obj object, vars map[string]interface{}) bool {
+		for _, collection := range collections {
+			recipients, _ := obj[collection].([]interface{})
+			for _, recipient := range recipients {
+				scope := map[string]interface{}{"r": recipient}
+				name, _ := resolve(obj, scope, "r/emailAddress/name").(string)
+				address, _ := resolve(obj, scope, "r/emailAddress/address").(string)
+				if containsText(name, text) || containsText(address, text) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// dateFilter compares the date of the datetime at path against value, which is a date such as 2024-01-31.
+func dateFilter(path, op, value string) (filter, error) {
+	var date time.Time
+	var err error
+	for _, format := range searchDateFormats {
+		if date, err = time.Parse(format, value); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid date '%s'", value)
+	}
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	var test func(int) bool
+	switch op {
+	case ":", "=":
+		test = func(c int) bool { return c == 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	}
+	return func(obj object, vars map[string]interface{}) bool {
+		s, _ := resolve(obj, vars, path).(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return false
+		}
+		t = t.UTC()
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return test(compareOrdered(day.Before(date), day.After(date)))
+	}, nil
+}
+
+// containsText reports whether value holds text, ignoring case and any trailing wildcard.
+func containsText(value, text string) bool {
+	text = strings.TrimSuffix(text, "*")
+	return text != "" && strings.Contains(strings.ToLower(value), strings.ToLower(text))
+}
@@ -0,0 +1,120 @@
+package outlooktest
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amhester/go-outlook/kql"
+)
+
+// searchParam wraps a KQL query in the double quotes graph expects of $search, escaping any quotes it holds.
+func searchParam(q string) url.Values {
+	return url.Values{"$search": {`"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(q) + `"`}}
+}
+
+func TestSearchObjects(t *testing.T) {
+	objs := testObjects(t,
+		`{
+			"id": "a",
+			"subject": "Weekly report",
+			"bodyPreview": "Numbers are up",
+			"receivedDateTime": "2024-01-31T09:00:00Z",
+			"sentDateTime": "2024-01-31T08:59:00Z",
+			"hasAttachments": true,
+			"attachments": [{"name": "q1-figures.xlsx"}],
+			"from": {"emailAddress": {"name": "Ann Lee", "address": "ann@contoso.com"}},
+			"toRecipients": [{"emailAddress": {"name": "Bob", "address": "bob@contoso.com"}}]
+		}`,
+		`{
+			"id": "b",
+			"subject": "Lunch?",
+			"body": {"content": "Are you free for lunch on Friday"},
+			"receivedDateTime": "2024-02-02T12:00:00Z",
+			"sentDateTime": "2024-02-02T11:59:00Z",
+			"from": {"emailAddress": {"name": "Bob", "address": "bob@contoso.com"}},
+			"toRecipients": [{"emailAddress": {"name": "Ann Lee", "address": "ann@contoso.com"}}],
+			"ccRecipients": [{"emailAddress": {"name": "Carol", "address": "carol@fabrikam.com"}}]
+		}`,
+		`{
+			"id": "c",
+			"subject": "Report or lunch",
+			"receivedDateTime": "2024-02-01T00:30:00Z",
+			"from": {"emailAddress": {"name": "Carol", "address": "carol@fabrikam.com"}}
+		}`,
+	)
+	evening := time.Date(2024, 1, 31, 20, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"report", "ca"},
+		{"REPORT", "ca"},
+		{"report lunch", "c"},
+		{"report AND lunch", "c"},
+		{"report OR lunch", "bca"},
+		{"report NOT lunch", "a"},
+		{"NOT (report OR lunch)", ""},
+		{`"weekly report"`, "a"},
+		{`subject:"weekly report"`, "a"},
+		{"from:ann", "a"},
+		{"from:contoso.com", "ba"},
+		{"to:ann", "b"},
+		{"cc:carol", "b"},
+		{"participants:carol", "bc"},
+		{"body:friday", "b"},
+		{"body:numbers", "a"},
+		{"attachment:figures", "a"},
+		{"hasAttachments:true", "a"},
+		{"hasAttachments:false", "bc"},
+		{"repo*", "ca"},
+		{"received>=2024-02-01", "bc"},
+		{"received<2024-02-01", "a"},
+		{"received=2024-01-31", "a"},
+		{"received:2/2/2024", "b"},
+		{"sent<=2024-01-31", "a"},
+		{kql.Received.Ge(evening).String(), "bc"},
+		{kql.And(kql.From("contoso"), kql.Received.Lt(evening)).String(), "a"},
+		{kql.Or(kql.Subject("weekly report"), kql.Participants("carol")).String(), "bca"},
+	}
+	for _, tt := range tests {
+		matched, res := searchObjects(searchParam(tt.query), objs)
+		if res != nil {
+			t.Errorf("search %q failed with %d: %s", tt.query, res.status, res.body)
+			continue
+		}
+		var got string
+		for _, obj := range matched {
+			got += obj.string("id")
+		}
+		if got != tt.want {
+			t.Errorf("search %q matched %q, want %q newest first", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchObjectsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"unquoted", url.Values{"$search": {"report"}}},
+		{"with $filter", url.Values{"$search": {`"report"`}, "$filter": {"isRead eq false"}}},
+		{"with $orderby", url.Values{"$search": {`"report"`}, "$orderby": {"subject"}}},
+		{"with $skip", url.Values{"$search": {`"report"`}, "$skip": {"10"}}},
+		{"unterminated phrase", searchParam(`"weekly report`)},
+		{"unbalanced parenthesis", searchParam("(report OR lunch")},
+		{"stray parenthesis", searchParam("report)")},
+		{"invalid date", searchParam("received>=yesterday")},
+		{"comparing text", searchParam("from>ann")},
+		{"dangling operator", searchParam("report AND")},
+	}
+	for _, tt := range tests {
+		if _, res := searchObjects(tt.query, nil); res == nil || res.status != http.StatusBadRequest {
+			t.Errorf("%s: search %v succeeded, want a 400", tt.name, tt.query)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package outlooktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	outlook "github.com/amhester/go-outlook"
+)
+
+const (
+	// apiVersion the version prefix the server serves graph's api under.
+	apiVersion = "/" + outlook.DefaultAPIVersion
+
+	// maxPageSize the largest $top graph accepts.
+	maxPageSize = 1000
+
+	// defaultPageSize the page size graph uses when no $top is given.
+	defaultPageSize = 10
+
+	// tokenLifetime how long the access tokens the server issues are valid for.
+	tokenLifetime = time.Hour
+
+	// timestampFormat the format of the timestamps the server sets on the objects it stores.
+	timestampFormat = "2006-01-02T15:04:05Z"
+)
+
+// Failure describes requests a Server should fail instead of serving, such as throttling of a single endpoint.
+type Failure struct {
+	// Method the http method of the requests to fail. Empty matches every method.
+	Method string
+	// Path a path.Match pattern for the path of the requests to fail, without the api version, e.g. /me/events/* or /*/oauth2/v2.0/token. Empty matches every path.
+	Path string
+	// Status the http status to fail with.
+	Status int
+	// Code the graph error code to fail with. Defaults to one matching Status.
+	Code string
+	// RetryAfter the value of the Retry-After header sent with the failure, if any.
+	RetryAfter time.Duration
+	// Times the number of requests to fail before serving them again. Zero or less fails every matching request.
+	Times int
+}
+
+// Server an in-memory fake of microsoft's graph api and token endpoint, serving the calendar and mail endpoints the client uses with realistic paging,
+// so that code built on a Session can be tested end to end. Mailboxes are created as they are first used, each with a default calendar and mail folders.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	mailboxes map[string]*mailbox
+	tokens    map[string]bool
+	failures  []*failure
+	requests  []*RecordedRequest
+	nextID    int
+}
+
+// NewServer returns a new instance of a running Server, which should be closed once no longer needed.
+func NewServer() *Server {
+	s := &Server{
+		mailboxes: map[string]*mailbox{},
+		tokens:    map[string]bool{},
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// ClientOpts returns the ClientOpt functions pointing a client's graph and token requests at the server.
+func (s *Server) ClientOpts() []outlook.ClientOpt {
+	return []outlook.ClientOpt{
+		outlook.SetClientGraphHost(s.URL),
+		outlook.SetClientAuthorityHost(s.URL),
+	}
+}
+
+// NewClient returns a new instance of a Client pointed at the server, configured with any other opts given.
+func (s *Server) NewClient(opts ...outlook.ClientOpt) (*outlook.Client, error) {
+	return outlook.NewClient(append(s.ClientOpts(), opts...)...)
+}
+
+// Fail makes the server fail the requests described by failure.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := f.Times
+	if remaining <= 0 {
+		remaining = -1
+	}
+	s.failures = append(s.failures, &failure{Failure: f, remaining: remaining})
+}
+
+// failure a Failure along with the number of requests it has left to fail, which is negative when unlimited.
+type failure struct {
+	Failure
+	remaining int
+}
+
+// Throttle makes the server answer the given number of requests matching method and pattern with a 429, asking for them to be retried after retryAfter.
+func (s *Server) Throttle(method, pattern string, times int, retryAfter time.Duration) {
+	s.Fail(Failure{
+		Method:     method,
+		Path:       pattern,
+		Status:     http.StatusTooManyRequests,
+		RetryAfter: retryAfter,
+		Times:      times,
+	})
+}
+
+// ClearFailures removes every failure given to the server.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// ExpireTokens invalidates every access token issued so far, so that sessions have to refresh them.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+// Requests returns the requests the server has received, including those made inside $batch requests.
+func (s *Server) Requests() []*RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*RecordedRequest(nil), s.requests...)
+}
+
+// ServeHTTP serves a request to the token endpoint or graph's api.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeResponse(w, graphError(http.StatusBadRequest, "BadRequest", err.Error()))
+		return
+	}
+	header := http.Header{}
+	if id := req.Header.Get(outlook.HeaderClientRequestID); id != "" {
+		header.Set(outlook.HeaderClientRequestID, id)
+	}
+
+	var res *response
+	switch {
+	case isTokenPath(req.URL.Path):
+		res = s.serveToken(req, body)
+	case !strings.HasPrefix(req.URL.Path, apiVersion+"/"):
+		res = graphError(http.StatusNotFound, "BadRequest", fmt.Sprintf("Invalid version: %s", req.URL.Path))
+	case !s.authorized(req):
+		res = graphError(http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token is empty or invalid.")
+	case req.URL.Path == apiVersion+"/$batch" && req.Method == http.MethodPost:
+		res = s.serveBatch(req, body)
+	default:
+		res = s.dispatch(req.Method, strings.TrimPrefix(req.URL.Path, apiVersion), req.URL.Query(), req.Header, body)
+	}
+	for key, values := range header {
+		res.header[key] = values
+	}
+	writeResponse(w, res)
+}
+
+// response a response to a request, which may be written out directly or as part of a $batch response.
+type response struct {
+	status int
+	header http.Header
+	body   interface{}
+}
+
+func newResponse(status int, body interface{}) *response {
+	return &response{status: status, header: http.Header{}, body: body}
+}
+
+func writeResponse(w http.ResponseWriter, res *response) {
+	for key, values := range res.header {
+		w.Header()[key] = values
+	}
+	if res.body == nil {
+		w.WriteHeader(res.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(res.status)
+	json.NewEncoder(w).Encode(res.body)
+}
+
+// graphErrorCodes the error code graph uses for each status, where it is consistent.
+var graphErrorCodes = map[int]string{
+	http.StatusBadRequest:          "BadRequest",
+	http.StatusUnauthorized:        "InvalidAuthenticationToken",
+	http.StatusForbidden:           "ErrorAccessDenied",
+	http.StatusNotFound:            "ErrorItemNotFound",
+	http.StatusConflict:            "ErrorConflict",
+	http.StatusPreconditionFailed:  "ErrorIrresolvableConflict",
+	http.StatusTooManyRequests:     "ApplicationThrottled",
+	http.StatusInternalServerError: "InternalServerError",
+	http.StatusServiceUnavailable:  "ServiceUnavailable",
+	http.StatusGatewayTimeout:      "GatewayTimeout",
+}
+
+func graphError(status int, code, message string) *response {
+	if code == "" {
+		code = graphErrorCodes[status]
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return newResponse(status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"innerError": map[string]interface{}{
+				"date":       time.Now().UTC().Format(timestampFormat),
+				"request-id": fmt.Sprintf("fake-%d", time.Now().UnixNano()),
+			},
+		},
+	})
+}
+
+// injectedFailure returns the failure response for a request matching one of the server's failures, or nil. It must be called with the lock held.
+func (s *Server) injectedFailure(method, p string) *response {
+	for _, failure := range s.failures {
+		if failure.Method != "" && failure.Method != method {
+			continue
+		}
+		if failure.Path != "" {
+			if ok, _ := path.Match(failure.Path, p); !ok {
+				continue
+			}
+		}
+		if failure.remaining == 0 {
+			continue
+		}
+		if failure.remaining > 0 {
+			failure.remaining--
+		}
+		res := graphError(failure.Status, failure.Code, "")
+		if failure.RetryAfter > 0 {
+			res.header.Set("Retry-After", strconv.Itoa(int(failure.RetryAfter.Seconds())))
+		}
+		return res
+	}
+	return nil
+}
+
+func (s *Server) record(method, rawURL string, header http.Header, body []byte) {
+	s.requests = append(s.requests, &RecordedRequest{
+		Method: method,
+		URL:    rawURL,
+		Header: redactHeader(header),
+		Body:   redactRequestBody(header.Get("Content-Type"), string(body)),
+	})
+}
+
+// isTokenPath reports whether p is the path of a tenant's token endpoint, e.g. /common/oauth2/v2.0/token.
+func isTokenPath(p string) bool {
+	segments := strings.Split(p, "/")
+	return len(segments) == 5 && segments[2] == "oauth2" && segments[3] == "v2.0" && segments[4] == "token"
+}
+
+// serveToken issues a new access token for any grant, so long as a grant type is given.
+func (s *Server) serveToken(req *http.Request, body []byte) *response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(req.Method, req.URL.String(), req.Header, body)
+	if res := s.injectedFailure(req.Method, req.URL.Path); res != nil {
+		return res
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil || req.Method != http.MethodPost || form.Get("grant_type") == "" {
+		return newResponse(http.StatusBadRequest, &outlook.TokenErrorResponse{
+			Error:            "invalid_request",
+			ErrorDescription: "AADSTS900144: The request body must contain the following parameter: 'grant_type'.",
+		})
+	}
+
+	s.nextID++
+	accessToken := fmt.Sprintf("fake-access-token-%d", s.nextID)
+	s.tokens[accessToken] = true
+	token := &outlook.RefreshTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(tokenLifetime.Seconds()),
+		Scope:       form.Get("scope"),
+	}
+	if form.Get("grant_type") != "client_credentials" {
+		token.RefreshToken = fmt.Sprintf("fake-refresh-token-%d", s.nextID)
+	}
+	return newResponse(http.StatusOK, token)
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")]
+}
+
+type batchRequest struct {
+	Requests []struct {
+		ID        string            `json:"id"`
+		Method    string            `json:"method"`
+		URL       string            `json:"url"`
+		DependsOn []string          `json:"dependsOn"`
+		Headers   map[string]string `json:"headers"`
+		Body      json.RawMessage   `json:"body"`
+	} `json:"requests"`
+}
+
+type batchResponse struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+}
+
+// serveBatch serves each request of a $batch request in order, failing those whose dependencies failed with a 424.
+func (s *Server) serveBatch(req *http.Request, body []byte) *response {
+	s.mu.Lock()
+	s.record(req.Method, req.URL.String(), req.Header, body)
+	res := s.injectedFailure(req.Method, "/$batch")
+	s.mu.Unlock()
+	if res != nil {
+		return res
+	}
+
+	var batch batchRequest
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return graphError(http.StatusBadRequest, "BadRequest", "Invalid batch payload format.")
+	}
+	if len(batch.Requests) > 20 {
+		return graphError(http.StatusBadRequest, "BadRequest", "Too many requests in a batch.")
+	}
+
+	status := map[string]int{}
+	var responses []*batchResponse
+	for _, subRequest := range batch.Requests {
+		subResponse := &batchResponse{ID: subRequest.ID}
+		var res *response
+		for _, dep := range subRequest.DependsOn {
+			if code, ok := status[dep]; !ok || code < 200 || code >= 300 {
+				res = graphError(http.StatusFailedDependency, "FailedDependency", "")
+			}
+		}
+		if res == nil {
+			u, err := url.Parse(subRequest.URL)
+			if err != nil {
+				res = graphError(http.StatusBadRequest, "BadRequest", "Invalid request URL.")
+			} else {
+				header := http.Header{}
+				for key, value := range subRequest.Headers {
+					header.Set(key, value)
+				}
+				var subBody []byte
+				if len(subRequest.Body) > 0 && string(subRequest.Body) != "null" {
+					subBody = subRequest.Body
+				}
+				res = s.dispatch(subRequest.Method, "/"+strings.TrimPrefix(u.Path, "/"), u.Query(), header, subBody)
+			}
+		}
+		status[subRequest.ID] = res.status
+		subResponse.Status = res.status
+		subResponse.Body = res.body
+		if len(res.header) > 0 {
+			subResponse.Headers = map[string]string{}
+			for key := range res.header {
+				subResponse.Headers[key] = res.header.Get(key)
+			}
+		}
+		responses = append(responses, subResponse)
+	}
+	return newResponse(http.StatusOK, map[string]interface{}{"responses": responses})
+}
@@ -0,0 +1,285 @@
+package outlooktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	outlook "github.com/amhester/go-outlook"
+	"github.com/amhester/go-outlook/odata"
+)
+
+// testSession returns a session signed in to the server through its token endpoint, which retries quickly.
+func testSession(t *testing.T, s *Server) *outlook.Session {
+	t.Helper()
+	client, err := s.NewClient(
+		outlook.SetClientAppID("app"),
+		outlook.SetClientAppSecret("secret"),
+		outlook.SetClientRetryPolicy(&outlook.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := outlook.NewSession(client, "refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// countRequests returns the number of requests the server has received whose url contains substr.
+func countRequests(s *Server, substr string) int {
+	count := 0
+	for _, req := range s.Requests() {
+		if strings.Contains(req.URL, substr) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestServerTokenFlow(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Once its token is invalidated the session is answered with a 401, refreshes and replays the request
+	s.ExpireTokens()
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := countRequests(s, "/oauth2/v2.0/token"); got != 2 {
+		t.Errorf("made %d token requests, want the sign in and one refresh", got)
+	}
+	for _, req := range s.Requests() {
+		if strings.Contains(req.URL, "/token") && (strings.Contains(req.Body, "=refresh-token") || strings.Contains(req.Body, "=secret")) {
+			t.Errorf("recorded token request holds credentials: %s", req.Body)
+		}
+	}
+
+	res, err := http.PostForm(s.URL+"/common/oauth2/v2.0/token", url.Values{"client_id": {"app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("token request without a grant got %d, want 400", res.StatusCode)
+	}
+	res, err = http.Get(s.URL + "/v1.0/me/calendars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request without a token got %d, want 401", res.StatusCode)
+	}
+}
+
+func TestServerPaging(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 25; i++ {
+		s.AddMessage("me", "inbox", &outlook.Message{
+			Subject:    fmt.Sprintf("message %02d", i),
+			ReceivedOn: start.Add(time.Duration(i) * time.Hour).Format(time.RFC3339),
+		})
+	}
+
+	first, err := session.Messages().List("inbox").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Value) != 10 || first.Total != 25 || first.NextLink == "" {
+		t.Errorf("first page has %d messages of %d and next link %q, want 10 of 25 and a link", len(first.Value), first.Total, first.NextLink)
+	}
+
+	messages, err := session.Messages().List("inbox").MaxResults(7).All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 25 {
+		t.Errorf("All() returned %d messages, want 25", len(messages))
+	}
+	if got := countRequests(s, "/mailFolders/inbox/messages"); got != 1+4 {
+		t.Errorf("made %d list requests, want the first page and four pages of seven", got)
+	}
+
+	// The window is filtered and ordered newest first by the server before paging
+	windowed, err := session.Messages().List("inbox").
+		StartTime(start.Add(20 * time.Hour)).
+		Filter(odata.Field("subject").Ne("message 24")).
+		MaxResults(2).
+		All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, message := range windowed {
+		subjects = append(subjects, message.Subject)
+	}
+	if got := strings.Join(subjects, ","); got != "message 23,message 22,message 21,message 20" {
+		t.Errorf("windowed messages %s", got)
+	}
+}
+
+func TestServerBatchDependsOn(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+	existing := s.AddCalendar("me", &outlook.Calendar{Name: "Existing"})
+
+	batch := session.Batch()
+	created := batch.Add(session.Calendars().Create().Calendar(&outlook.Calendar{Name: "Created"}))
+	renamed := batch.Add(session.Calendars().Update(existing.ID).Calendar(&outlook.Calendar{Name: "Renamed"})).DependsOn(created)
+	missing := batch.Add(session.Calendars().Get("missing"))
+	skipped := batch.Add(session.Calendars().Delete(existing.ID)).DependsOn(missing)
+	if err := batch.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Status() != http.StatusCreated || renamed.Status() != http.StatusOK {
+		t.Errorf("create and dependent update got %d and %d, want 201 and 200", created.Status(), renamed.Status())
+	}
+	if missing.Status() != http.StatusNotFound {
+		t.Errorf("get of a missing calendar got %d, want 404", missing.Status())
+	}
+	var statusErr *outlook.ErrStatusCode
+	if skipped.Status() != http.StatusFailedDependency || !errors.As(skipped.Err(), &statusErr) {
+		t.Errorf("delete depending on the failed get got %d, %v, want a 424", skipped.Status(), skipped.Err())
+	}
+
+	var names []string
+	for _, calendar := range s.Calendars("me") {
+		names = append(names, calendar.Name)
+	}
+	if got := strings.Join(names, ","); got != "Calendar,Renamed,Created" {
+		t.Errorf("stored calendars %s, want the rename applied and the delete skipped", got)
+	}
+	if got := countRequests(s, "/$batch"); got != 1 {
+		t.Errorf("made %d $batch requests, want 1", got)
+	}
+}
+
+func TestServerFailureInjection(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+
+	// Throttled requests are retried by the client until the server serves them again
+	s.Throttle(http.MethodGet, "/me/calendars", 2, 0)
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Fatalf("throttled list failed with %v, want it retried", err)
+	}
+	if got := countRequests(s, "/me/calendars"); got != 3 {
+		t.Errorf("made %d list requests, want two throttled and one served", got)
+	}
+
+	s.Fail(Failure{Method: http.MethodDelete, Path: "/me/calendars/*", Status: http.StatusForbidden})
+	err := session.Calendars().Delete("any").Do(ctx)
+	var statusErr *outlook.ErrStatusCode
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusForbidden || statusErr.ErrorCode != "ErrorAccessDenied" {
+		t.Errorf("failed delete got %v, want graph's 403", err)
+	}
+	// Failures only match their method and path
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Errorf("list failed with %v while only deletes fail", err)
+	}
+
+	s.ClearFailures()
+	s.Fail(Failure{Path: "/*/oauth2/v2.0/token", Status: http.StatusServiceUnavailable})
+	s.ExpireTokens()
+	if _, err := session.Calendars().List().Do(ctx); err == nil {
+		t.Error("list succeeded while the token endpoint fails")
+	}
+	s.ClearFailures()
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Errorf("list failed with %v once the token endpoint recovered", err)
+	}
+}
+
+func TestServerIfMatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+	added := s.AddEvent("me", "", &outlook.Event{Subject: "Planning"})
+
+	read, err := session.Events().Get("primary", added.ID).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Someone else changes the event after it was read, which gives it a new etag
+	if _, err := session.Events().Update("primary").Event(&outlook.Event{ID: added.ID, Subject: "Moved"}).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = session.Events().Update("primary").Event(&outlook.Event{ID: added.ID, Subject: "Renamed"}).IfMatch(read.ETag).Do(ctx)
+	var statusErr *outlook.ErrStatusCode
+	if !errors.Is(err, outlook.ErrPreconditionFailed) || !errors.As(err, &statusErr) || statusErr.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale etag failed with %v, want ErrPreconditionFailed", err)
+	}
+	requests := s.Requests()
+	if got := requests[len(requests)-1].Header.Get("If-Match"); got != read.ETag {
+		t.Errorf("update sent If-Match %q, want %q", got, read.ETag)
+	}
+	if events := s.Events("me", ""); events[0].Subject != "Moved" {
+		t.Errorf("stored subject %q, want the stale update rejected", events[0].Subject)
+	}
+
+	current, err := session.Events().Get("primary", added.ID).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Events().Update("primary").Event(&outlook.Event{ID: added.ID, Subject: "Renamed"}).IfMatch(current.ETag).Do(ctx); err != nil {
+		t.Errorf("update with the current etag failed with %v", err)
+	}
+}
+
+func TestServerBatchIfMatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	session := testSession(t, s)
+	ctx := context.Background()
+	added := s.AddCalendar("me", &outlook.Calendar{Name: "Team"})
+
+	batch := session.Batch()
+	stale := batch.Add(session.Calendars().Update(added.ID).Calendar(&outlook.Calendar{Name: "Stale"}).IfMatch(`W/"stale"`))
+	current := batch.Add(session.Calendars().Update(added.ID).Calendar(&outlook.Calendar{Name: "Renamed"}).IfMatch(added.ETag))
+	if err := batch.Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(stale.Err(), outlook.ErrPreconditionFailed) {
+		t.Errorf("batched update with a stale etag failed with %v, want ErrPreconditionFailed", stale.Err())
+	}
+	if current.Status() != http.StatusOK {
+		t.Errorf("batched update with the current etag got %d, %v, want 200", current.Status(), current.Err())
+	}
+
+	var ifMatch []string
+	for _, req := range s.Requests() {
+		if req.Method == http.MethodPatch {
+			ifMatch = append(ifMatch, req.Header.Get("If-Match"))
+		}
+	}
+	if got, want := strings.Join(ifMatch, ","), `W/"stale",`+added.ETag; got != want {
+		t.Errorf("batched sub-requests carried If-Match %s, want %s", got, want)
+	}
+	if got := s.Calendars("me")[1].Name; got != "Renamed" {
+		t.Errorf("stored calendar %q, want only the current update applied", got)
+	}
+}
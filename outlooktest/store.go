@@ -0,0 +1,700 @@
+package outlooktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	outlook "github.com/amhester/go-outlook"
+)
+
+// wellKnownFolders the mail folders every mailbox starts with, keyed by the well-known name they can also be addressed by.
+var wellKnownFolders = []struct {
+	name        string
+	displayName string
+}{
+	{"inbox", "Inbox"},
+	{"drafts", "Drafts"},
+	{"sentitems", "Sent Items"},
+	{"deleteditems", "Deleted Items"},
+	{"archive", "Archive"},
+	{"junkemail", "Junk Email"},
+}
+
+// readOnlyFields the fields a patch can't change.
+var readOnlyFields = map[string]bool{
+	"id":                   true,
+	"@odata.etag":          true,
+	"createdDateTime":      true,
+	"lastModifiedDateTime": true,
+	"parentFolderId":       true,
+}
+
+// eventDateTimeFormats the formats graph accepts for the dateTime of an event's start and end.
+var eventDateTimeFormats = []string{
+	"2006-01-02T15:04:05.0000000",
+	"2006-01-02T15:04:05",
+	time.RFC3339Nano,
+}
+
+// object a json object stored by the server, which keeps any fields it is given.
+type object map[string]interface{}
+
+func (obj object) string(key string) string {
+	s, _ := obj[key].(string)
+	return s
+}
+
+// collection an ordered set of objects keyed by id.
+type collection struct {
+	ids   []string
+	items map[string]object
+}
+
+func newCollection() *collection {
+	return &collection{items: map[string]object{}}
+}
+
+func (c *collection) add(obj object) {
+	id := obj.string("id")
+	c.ids = append(c.ids, id)
+	c.items[id] = obj
+}
+
+func (c *collection) get(id string) (object, bool) {
+	obj, ok := c.items[id]
+	return obj, ok
+}
+
+func (c *collection) remove(id string) bool {
+	if _, ok := c.items[id]; !ok {
+		return false
+	}
+	delete(c.items, id)
+	for i, existing := range c.ids {
+		if existing == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (c *collection) list() []object {
+	objs := make([]object, 0, len(c.ids))
+	for _, id := range c.ids {
+		objs = append(objs, c.items[id])
+	}
+	return objs
+}
+
+// mailbox the calendars and mail of a single user.
+type mailbox struct {
+	calendars       *collection
+	defaultCalendar string
+	events          map[string]*collection
+	folders         *collection
+	wellKnown       map[string]string
+	messages        map[string]*collection
+}
+
+// mailbox returns the mailbox with the given key, creating it with a default calendar and mail folders if needed. It must be called with the lock held.
+func (s *Server) mailbox(key string) *mailbox {
+	key = strings.ToLower(key)
+	if mb, ok := s.mailboxes[key]; ok {
+		return mb
+	}
+
+	mb := &mailbox{
+		calendars: newCollection(),
+		events:    map[string]*collection{},
+		folders:   newCollection(),
+		wellKnown: map[string]string{},
+		messages:  map[string]*collection{},
+	}
+	calendar := s.newObject("calendar", object{
+		"name":              "Calendar",
+		"isDefaultCalendar": true,
+		"canEdit":           true,
+		"canShare":          true,
+	})
+	mb.calendars.add(calendar)
+	mb.defaultCalendar = calendar.string("id")
+	mb.events[mb.defaultCalendar] = newCollection()
+	for _, wk := range wellKnownFolders {
+		folder := s.newObject("folder", object{"displayName": wk.displayName})
+		mb.folders.add(folder)
+		mb.wellKnown[wk.name] = folder.string("id")
+		mb.messages[folder.string("id")] = newCollection()
+	}
+	s.mailboxes[key] = mb
+	return mb
+}
+
+// folderID resolves the well-known names of folders, such as inbox, to their ids.
+func (mb *mailbox) folderID(id string) string {
+	if wellKnown, ok := mb.wellKnown[strings.ToLower(id)]; ok {
+		return wellKnown
+	}
+	return id
+}
+
+// calendarID resolves the primary alias the client uses for a user's default calendar.
+func (mb *mailbox) calendarID(id string) string {
+	if id == "" || id == "primary" {
+		return mb.defaultCalendar
+	}
+	return id
+}
+
+// findEvent returns the calendar holding the event with the given id.
+func (mb *mailbox) findEvent(id string) *collection {
+	for _, events := range mb.events {
+		if _, ok := events.get(id); ok {
+			return events
+		}
+	}
+	return nil
+}
+
+// findMessage returns the folder holding the message with the given id.
+func (mb *mailbox) findMessage(id string) *collection {
+	for _, messages := range mb.messages {
+		if _, ok := messages.get(id); ok {
+			return messages
+		}
+	}
+	return nil
+}
+
+// newObject gives obj a new id and etag, along with the timestamps graph sets. It must be called with the lock held.
+func (s *Server) newObject(kind string, obj object) object {
+	s.nextID++
+	now := time.Now().UTC().Format(timestampFormat)
+	obj["id"] = fmt.Sprintf("%s-%d", kind, s.nextID)
+	obj["@odata.etag"] = fmt.Sprintf(`W/"%d"`, s.nextID)
+	if kind == "event" || kind == "message" {
+		if obj.string("createdDateTime") == "" {
+			obj["createdDateTime"] = now
+		}
+		obj["lastModifiedDateTime"] = now
+	}
+	return obj
+}
+
+// patchObject applies the writable fields of patch to obj, giving it a new etag. It must be called with the lock held.
+func (s *Server) patchObject(obj, patch object) {
+	for key, value := range patch {
+		if !readOnlyFields[key] {
+			obj[key] = value
+		}
+	}
+	s.nextID++
+	obj["@odata.etag"] = fmt.Sprintf(`W/"%d"`, s.nextID)
+	if _, ok := obj["lastModifiedDateTime"]; ok {
+		obj["lastModifiedDateTime"] = time.Now().UTC().Format(timestampFormat)
+	}
+}
+
+// dispatch serves a request to graph's api, whose path has had the api version removed.
+func (s *Server) dispatch(method, p string, query url.Values, header http.Header, body []byte) *response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rawURL := s.URL + apiVersion + p
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+	s.record(method, rawURL, header, body)
+	if res := s.injectedFailure(method, p); res != nil {
+		return res
+	}
+
+	var patch object
+	if method == http.MethodPost || method == http.MethodPatch {
+		if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+			return graphError(http.StatusBadRequest, "BadRequest", "Empty Payload. JSON content expected.")
+		}
+	}
+
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	var prefix string
+	switch {
+	case segments[0] == "me":
+		prefix, segments = "/me", segments[1:]
+	case segments[0] == "users" && len(segments) > 1:
+		prefix, segments = "/users/"+segments[1], segments[2:]
+	default:
+		return graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Resource not found for the segment '%s'.", segments[0]))
+	}
+	mb := s.mailbox(strings.TrimPrefix(strings.TrimPrefix(prefix, "/users/"), "/"))
+
+	req := &apiRequest{
+		method:  method,
+		path:    p,
+		query:   query,
+		ifMatch: header.Get("If-Match"),
+		patch:   patch,
+	}
+	switch {
+	case match(segments, "calendars"):
+		return s.serveCollection(req, mb.calendars, "calendar", nil)
+	case match(segments, "calendars", "*"):
+		if segments[1] == mb.defaultCalendar && method == http.MethodDelete {
+			return graphError(http.StatusBadRequest, "ErrorInvalidRequest", "Cannot delete the default calendar.")
+		}
+		res := s.serveItem(req, mb.calendars, segments[1])
+		if method == http.MethodDelete && res.status == http.StatusNoContent {
+			delete(mb.events, segments[1])
+		}
+		return res
+	case match(segments, "calendarView"):
+		return s.serveCalendarView(req, mb.events[mb.defaultCalendar])
+	case match(segments, "calendars", "*", "calendarView"):
+		return s.serveCalendarView(req, mb.events[mb.calendarID(segments[1])])
+	case match(segments, "events"):
+		return s.serveCollection(req, mb.events[mb.defaultCalendar], "event", nil)
+	case match(segments, "events", "*"):
+		return s.serveItem(req, mb.findEvent(segments[1]), segments[1])
+	case match(segments, "calendars", "*", "events"):
+		return s.serveCollection(req, mb.events[mb.calendarID(segments[1])], "event", nil)
+	case match(segments, "calendars", "*", "events", "*"):
+		return s.serveItem(req, mb.events[mb.calendarID(segments[1])], segments[3])
+	case match(segments, "mailFolders"):
+		res := s.serveCollection(req, mb.folders, "folder", nil)
+		if method == http.MethodPost && res.status == http.StatusCreated {
+			mb.messages[res.body.(object).string("id")] = newCollection()
+		}
+		return s.withFolderCounts(mb, res)
+	case match(segments, "mailFolders", "*"):
+		id := mb.folderID(segments[1])
+		for _, wellKnown := range mb.wellKnown {
+			if id == wellKnown && method == http.MethodDelete {
+				return graphError(http.StatusForbidden, "ErrorDeleteDistinguishedFolder", "Distinguished folders cannot be deleted.")
+			}
+		}
+		res := s.serveItem(req, mb.folders, id)
+		if method == http.MethodDelete && res.status == http.StatusNoContent {
+			delete(mb.messages, id)
+		}
+		return s.withFolderCounts(mb, res)
+	case match(segments, "mailFolders", "*", "messages"):
+		id := mb.folderID(segments[1])
+		return s.serveCollection(req, mb.messages[id], "message", object{"parentFolderId": id})
+	case match(segments, "mailFolders", "*", "messages", "*"):
+		return s.serveItem(req, mb.messages[mb.folderID(segments[1])], segments[3])
+	case match(segments, "messages"):
+		if method == http.MethodPost {
+			id := mb.wellKnown["drafts"]
+			return s.serveCollection(req, mb.messages[id], "message", object{"parentFolderId": id, "isDraft": true})
+		}
+		var all []object
+		for _, folder := range mb.folders.list() {
+			all = append(all, mb.messages[folder.string("id")].list()...)
+		}
+		return s.serveList(req, all)
+	case match(segments, "messages", "*"):
+		return s.serveItem(req, mb.findMessage(segments[1]), segments[1])
+	}
+	return graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Unsupported request: %s %s", method, p))
+}
+
+// apiRequest the parts of a request to graph's api its handlers use.
+type apiRequest struct {
+	method  string
+	path    string
+	query   url.Values
+	ifMatch string
+	patch   object
+}
+
+// match reports whether the path segments match the given pattern, where * matches any single segment.
+func match(segments []string, pattern ...string) bool {
+	if len(segments) != len(pattern) {
+		return false
+	}
+	for i, segment := range pattern {
+		if segment != "*" && segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// serveCollection lists the objects of c, or creates a new one of the given kind in it with any defaults given.
+func (s *Server) serveCollection(req *apiRequest, c *collection, kind string, defaults object) *response {
+	if c == nil {
+		return graphError(http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+	}
+	switch req.method {
+	case http.MethodGet:
+		return s.serveList(req, c.list())
+	case http.MethodPost:
+		obj := object{}
+		for key, value := range defaults {
+			obj[key] = value
+		}
+		for key, value := range req.patch {
+			obj[key] = value
+		}
+		s.newObject(kind, obj)
+		c.add(obj)
+		return newResponse(http.StatusCreated, selectFields(obj, nil))
+	}
+	return graphError(http.StatusMethodNotAllowed, "BadRequest", "Method not allowed.")
+}
+
+// serveItem gets, updates or deletes the object of c with the given id.
+func (s *Server) serveItem(req *apiRequest, c *collection, id string) *response {
+	var obj object
+	if c != nil {
+		obj, _ = c.get(id)
+	}
+	if obj == nil {
+		return graphError(http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+	}
+	if req.method != http.MethodGet && req.ifMatch != "" && req.ifMatch != "*" && req.ifMatch != obj.string("@odata.etag") {
+		return graphError(http.StatusPreconditionFailed, "ErrorIrresolvableConflict",
+			"The send or update operation could not be performed because the change key passed in the request does not match the current change key for the item.")
+	}
+	switch req.method {
+	case http.MethodGet:
+		return newResponse(http.StatusOK, selectFields(obj, req.query))
+	case http.MethodPatch:
+		s.patchObject(obj, req.patch)
+		return newResponse(http.StatusOK, selectFields(obj, nil))
+	case http.MethodDelete:
+		c.remove(id)
+		return newResponse(http.StatusNoContent, nil)
+	}
+	return graphError(http.StatusMethodNotAllowed, "BadRequest", "Method not allowed.")
+}
+
+// serveCalendarView lists the events of a calendar which overlap the window given by the startDateTime and endDateTime parameters.
+func (s *Server) serveCalendarView(req *apiRequest, events *collection) *response {
+	if events == nil {
+		return graphError(http.StatusNotFound, "ErrorItemNotFound", "The specified object was not found in the store.")
+	}
+	if req.method != http.MethodGet {
+		return graphError(http.StatusMethodNotAllowed, "BadRequest", "Method not allowed.")
+	}
+	start, startErr := time.Parse(time.RFC3339, req.query.Get("startDateTime"))
+	end, endErr := time.Parse(time.RFC3339, req.query.Get("endDateTime"))
+	if startErr != nil || endErr != nil {
+		return graphError(http.StatusBadRequest, "ErrorInvalidParameter",
+			"This request requires a time window specified by the query string parameters StartDateTime and EndDateTime.")
+	}
+
+	var inView []object
+	for _, event := range events.list() {
+		eventStart, ok := eventTime(event["start"])
+		if !ok {
+			continue
+		}
+		eventEnd, ok := eventTime(event["end"])
+		if !ok {
+			eventEnd = eventStart
+		}
+		if eventStart.Before(end) && eventEnd.After(start) {
+			inView = append(inView, event)
+		}
+	}
+	return s.serveList(req, inView)
+}
+
+// eventTime parses an event's dateTimeTimeZone object.
+func eventTime(value interface{}) (time.Time, bool) {
+	dtz, ok := value.(map[string]interface{})
+	if !ok {
+		return time.Time{}, false
+	}
+	dateTime, _ := dtz["dateTime"].(string)
+	timeZone, _ := dtz["timeZone"].(string)
+	loc := time.UTC
+	if timeZone != "" {
+		if l, err := time.LoadLocation(timeZone); err == nil {
+			loc = l
+		}
+	}
+	for _, format := range eventDateTimeFormats {
+		if t, err := time.ParseInLocation(format, dateTime, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// serveList serves a page of objs according to the $filter, $orderby, $top, $skip and $count parameters, linking to the next page if there is one.
+// A $search is paged with a $skiptoken in place of $skip, as graph does.
+func (s *Server) serveList(req *apiRequest, objs []object) *response {
+	skipParam := "$skip"
+	if req.query.Get("$search") != "" {
+		var res *response
+		if objs, res = searchObjects(req.query, objs); res != nil {
+			return res
+		}
+		skipParam = "$skiptoken"
+	}
+	if expression := req.query.Get("$filter"); expression != "" {
+		f, err := parseFilter(expression)
+		if err != nil {
+			return graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid filter clause: %v", err))
+		}
+		var filtered []object
+		for _, obj := range objs {
+			if f(obj, nil) {
+				filtered = append(filtered, obj)
+			}
+		}
+		objs = filtered
+	}
+	if orderBy := req.query.Get("$orderby"); orderBy != "" {
+		objs = sortObjects(objs, orderBy)
+	}
+
+	top, skip := defaultPageSize, 0
+	if value := req.query.Get("$top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid page size specified: '%s'.", value))
+		}
+		top = n
+	}
+	if value := req.query.Get(skipParam); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return graphError(http.StatusBadRequest, "BadRequest", fmt.Sprintf("Invalid skip specified: '%s'.", value))
+		}
+		skip = n
+	}
+
+	end := skip + top
+	if skip > len(objs) {
+		skip = len(objs)
+	}
+	if end > len(objs) {
+		end = len(objs)
+	}
+	value := make([]object, 0, end-skip)
+	for _, obj := range objs[skip:end] {
+		value = append(value, selectFields(obj, req.query))
+	}
+
+	result := object{
+		"@odata.context": fmt.Sprintf("%s%s/$metadata#%s", s.URL, apiVersion, strings.Trim(req.path, "/")),
+		"value":          value,
+	}
+	if strings.EqualFold(req.query.Get("$count"), "true") {
+		result["@odata.count"] = len(objs)
+	}
+	if end < len(objs) {
+		next := url.Values{}
+		for key, values := range req.query {
+			next[key] = values
+		}
+		next.Set(skipParam, strconv.Itoa(end))
+		result["@odata.nextLink"] = fmt.Sprintf("%s%s%s?%s", s.URL, apiVersion, req.path, next.Encode())
+	}
+	return newResponse(http.StatusOK, result)
+}
+
+// selectFields returns a copy of obj holding only the fields named by the $select parameter, along with its id and etag.
+func selectFields(obj object, query url.Values) object {
+	var fields []string
+	if query != nil && query.Get("$select") != "" {
+		fields = strings.Split(query.Get("$select"), ",")
+	}
+	selected := object{}
+	for key, value := range obj {
+		selected[key] = value
+	}
+	if len(fields) == 0 {
+		return selected
+	}
+	keep := map[string]bool{"id": true, "@odata.etag": true}
+	for _, field := range fields {
+		keep[strings.TrimSpace(field)] = true
+	}
+	for key := range selected {
+		if !keep[key] {
+			delete(selected, key)
+		}
+	}
+	return selected
+}
+
+// withFolderCounts fills in the item counts of the folders in a response.
+func (s *Server) withFolderCounts(mb *mailbox, res *response) *response {
+	var folders []object
+	switch body := res.body.(type) {
+	case object:
+		if value, ok := body["value"].([]object); ok {
+			folders = value
+		} else if body.string("id") != "" {
+			folders = []object{body}
+		}
+	}
+	for _, folder := range folders {
+		messages := mb.messages[folder.string("id")]
+		if messages == nil {
+			continue
+		}
+		unread := 0
+		for _, message := range messages.list() {
+			if isRead, _ := message["isRead"].(bool); !isRead {
+				unread++
+			}
+		}
+		folder["totalItemCount"] = len(messages.ids)
+		folder["unreadItemCount"] = unread
+		folder["childFolderCount"] = 0
+	}
+	return res
+}
+
+// AddCalendar stores a new calendar in the given mailbox, returning it with the id it was given. The mailbox me is the one /me requests are served from.
+func (s *Server) AddCalendar(mailbox string, calendar *outlook.Calendar) *outlook.Calendar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	obj := s.newObject("calendar", toObject(calendar))
+	mb.calendars.add(obj)
+	mb.events[obj.string("id")] = newCollection()
+	var added outlook.Calendar
+	fromObject(obj, &added)
+	return &added
+}
+
+// AddEvent stores a new event in the given calendar of a mailbox, or its default calendar if calendarID is empty or primary.
+// It returns the event with the id it was given, or nil if the calendar doesn't exist.
+func (s *Server) AddEvent(mailbox, calendarID string, event *outlook.Event) *outlook.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	events := mb.events[mb.calendarID(calendarID)]
+	if events == nil {
+		return nil
+	}
+	obj := s.newObject("event", toObject(event))
+	events.add(obj)
+	var added outlook.Event
+	fromObject(obj, &added)
+	return &added
+}
+
+// AddFolder stores a new mail folder in the given mailbox, returning it with the id it was given.
+func (s *Server) AddFolder(mailbox string, folder *outlook.Folder) *outlook.Folder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	obj := s.newObject("folder", toObject(folder))
+	mb.folders.add(obj)
+	mb.messages[obj.string("id")] = newCollection()
+	var added outlook.Folder
+	fromObject(obj, &added)
+	return &added
+}
+
+// AddMessage stores a new message in the given folder of a mailbox, which may be given by a well-known name such as inbox.
+// It returns the message with the id it was given, or nil if the folder doesn't exist.
+func (s *Server) AddMessage(mailbox, folderID string, message *outlook.Message) *outlook.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	id := mb.folderID(folderID)
+	messages := mb.messages[id]
+	if messages == nil {
+		return nil
+	}
+	obj := toObject(message)
+	obj["parentFolderId"] = id
+	if obj.string("receivedDateTime") == "" {
+		obj["receivedDateTime"] = time.Now().UTC().Format(timestampFormat)
+	}
+	s.newObject("message", obj)
+	messages.add(obj)
+	var added outlook.Message
+	fromObject(obj, &added)
+	return &added
+}
+
+// Calendars returns the calendars stored in the given mailbox.
+func (s *Server) Calendars(mailbox string) []*outlook.Calendar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calendars []*outlook.Calendar
+	for _, obj := range s.mailbox(mailbox).calendars.list() {
+		var calendar outlook.Calendar
+		fromObject(obj, &calendar)
+		calendars = append(calendars, &calendar)
+	}
+	return calendars
+}
+
+// Events returns the events stored in the given calendar of a mailbox, or its default calendar if calendarID is empty or primary.
+func (s *Server) Events(mailbox, calendarID string) []*outlook.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	events := mb.events[mb.calendarID(calendarID)]
+	if events == nil {
+		return nil
+	}
+	var list []*outlook.Event
+	for _, obj := range events.list() {
+		var event outlook.Event
+		fromObject(obj, &event)
+		list = append(list, &event)
+	}
+	return list
+}
+
+// Folders returns the mail folders stored in the given mailbox.
+func (s *Server) Folders(mailbox string) []*outlook.Folder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	res := s.withFolderCounts(mb, newResponse(http.StatusOK, object{"value": mb.folders.list()}))
+	var folders []*outlook.Folder
+	for _, obj := range res.body.(object)["value"].([]object) {
+		var folder outlook.Folder
+		fromObject(obj, &folder)
+		folders = append(folders, &folder)
+	}
+	return folders
+}
+
+// Messages returns the messages stored in the given folder of a mailbox, which may be given by a well-known name such as inbox.
+func (s *Server) Messages(mailbox, folderID string) []*outlook.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mb := s.mailbox(mailbox)
+	messages := mb.messages[mb.folderID(folderID)]
+	if messages == nil {
+		return nil
+	}
+	var list []*outlook.Message
+	for _, obj := range messages.list() {
+		var message outlook.Message
+		fromObject(obj, &message)
+		list = append(list, &message)
+	}
+	return list
+}
+
+func toObject(v interface{}) object {
+	obj := object{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &obj)
+	}
+	return obj
+}
+
+func fromObject(obj object, v interface{}) {
+	if data, err := json.Marshal(obj); err == nil {
+		json.Unmarshal(data, v)
+	}
+}
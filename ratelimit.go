@@ -0,0 +1,238 @@
+package outlook
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit configures a RateLimiter.
+type RateLimit struct {
+	// Requests the number of requests allowed to a mailbox per Window.
+	Requests int
+	// Window the period over which Requests are allowed.
+	Window time.Duration
+	// Burst the number of requests which can be made back to back before being paced. Defaults to Requests.
+	Burst int
+	// MaxConcurrent the number of requests which can be in flight to a mailbox at once. Zero means no cap.
+	MaxConcurrent int
+}
+
+// DefaultRateLimit matches the limits graph applies to the outlook service, of 10,000 requests per 10 minutes and 4 concurrent requests per mailbox.
+var DefaultRateLimit = RateLimit{
+	Requests:      10000,
+	Window:        10 * time.Minute,
+	MaxConcurrent: 4,
+}
+
+// RateLimiterStats metrics on how requests to one or more mailboxes were held back by a RateLimiter.
+type RateLimiterStats struct {
+	Requests  int64
+	Delayed   int64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+func (stats *RateLimiterStats) add(other RateLimiterStats) {
+	stats.Requests += other.Requests
+	stats.Delayed += other.Delayed
+	stats.TotalWait += other.TotalWait
+	if other.MaxWait > stats.MaxWait {
+		stats.MaxWait = other.MaxWait
+	}
+}
+
+// rateLimiterSweepInterval how often a RateLimiter looks for idle mailboxes to evict when it starts tracking another.
+const rateLimiterSweepInterval = time.Minute
+
+// RateLimiter a client side limiter which paces requests to each mailbox with a token bucket and caps how many are in flight at once,
+// so that fan-out work stays under graph's throttling limits instead of being answered with 429s.
+// Mailboxes with no requests in flight whose buckets have refilled are evicted, so fanning out across many mailboxes doesn't grow it without bound.
+type RateLimiter struct {
+	limit     RateLimit
+	mu        sync.Mutex
+	mailboxes map[string]*mailboxLimiter
+	evicted   RateLimiterStats
+	swept     time.Time
+}
+
+type mailboxLimiter struct {
+	tokens float64
+	last   time.Time
+	slots  chan struct{}
+	refs   int
+	stats  RateLimiterStats
+}
+
+// NewRateLimiter returns a new instance of a RateLimiter applying the given limit to each mailbox.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = limit.Requests
+	}
+	return &RateLimiter{
+		limit:     limit,
+		mailboxes: map[string]*mailboxLimiter{},
+		swept:     time.Now(),
+	}
+}
+
+// SetClientRateLimiter returns a ClientOpt function which sets the limiter sessions consult before sending each request.
+func SetClientRateLimiter(limiter *RateLimiter) ClientOpt {
+	return func(c *Client) {
+		c.rateLimiter = limiter
+	}
+}
+
+// SetRateLimiter fluent configuration of the limiter sessions consult before sending each request.
+func (client *Client) SetRateLimiter(limiter *RateLimiter) *Client {
+	client.rateLimiter = limiter
+	return client
+}
+
+// Wait blocks until a request to the given mailbox is allowed, returning a function which must be called once the request has finished.
+func (rl *RateLimiter) Wait(ctx context.Context, mailbox string) (func(), error) {
+	return rl.WaitN(ctx, mailbox, 1)
+}
+
+// WaitN blocks until n requests to the given mailbox are allowed, such as the sub-requests of a $batch, which graph counts individually.
+// They take a single concurrency slot, as they are sent together. The returned function must be called once the request has finished.
+func (rl *RateLimiter) WaitN(ctx context.Context, mailbox string, n int) (func(), error) {
+	if n < 1 {
+		n = 1
+	}
+	start := time.Now()
+	mb := rl.acquire(mailbox)
+
+	release := func() { rl.releaseMailbox(mb) }
+	if mb.slots != nil {
+		select {
+		case mb.slots <- struct{}{}:
+			release = func() {
+				<-mb.slots
+				rl.releaseMailbox(mb)
+			}
+		case <-ctx.Done():
+			rl.releaseMailbox(mb)
+			return nil, ctx.Err()
+		}
+	}
+
+	if delay := rl.reserve(mb, n); delay > 0 {
+		if err := sleepContext(ctx, delay); err != nil {
+			rl.mu.Lock()
+			mb.tokens += float64(n)
+			rl.mu.Unlock()
+			release()
+			return nil, err
+		}
+	}
+
+	waited := time.Since(start)
+	rl.mu.Lock()
+	mb.stats.Requests += int64(n)
+	if waited >= time.Millisecond {
+		mb.stats.Delayed++
+		mb.stats.TotalWait += waited
+		if waited > mb.stats.MaxWait {
+			mb.stats.MaxWait = waited
+		}
+	}
+	rl.mu.Unlock()
+
+	return release, nil
+}
+
+// Stats returns the metrics for the given mailbox, keyed as by Session.Mailbox. Mailboxes which have been evicted while idle start counting again from zero.
+func (rl *RateLimiter) Stats(mailbox string) RateLimiterStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if mb, ok := rl.mailboxes[mailbox]; ok {
+		return mb.stats
+	}
+	return RateLimiterStats{}
+}
+
+// TotalStats returns the metrics summed across every mailbox.
+func (rl *RateLimiter) TotalStats() RateLimiterStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	total := rl.evicted
+	for _, mb := range rl.mailboxes {
+		total.add(mb.stats)
+	}
+	return total
+}
+
+// acquire returns the limiter of the given mailbox, which is kept from being evicted until releaseMailbox is called.
+func (rl *RateLimiter) acquire(mailbox string) *mailboxLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	mb, ok := rl.mailboxes[mailbox]
+	if !ok {
+		now := time.Now()
+		if now.Sub(rl.swept) >= rateLimiterSweepInterval {
+			rl.sweep(now)
+		}
+		mb = &mailboxLimiter{
+			tokens: float64(rl.limit.Burst),
+			last:   now,
+		}
+		if rl.limit.MaxConcurrent > 0 {
+			mb.slots = make(chan struct{}, rl.limit.MaxConcurrent)
+		}
+		rl.mailboxes[mailbox] = mb
+	}
+	mb.refs++
+	return mb
+}
+
+func (rl *RateLimiter) releaseMailbox(mb *mailboxLimiter) {
+	rl.mu.Lock()
+	mb.refs--
+	rl.mu.Unlock()
+}
+
+// sweep evicts the mailboxes which are in the same state as a new one would be, with nothing in flight or waiting and a full bucket,
+// so evicting them changes nothing but the memory held. Their stats are kept in the totals.
+func (rl *RateLimiter) sweep(now time.Time) {
+	rl.swept = now
+	for key, mb := range rl.mailboxes {
+		if mb.refs > 0 || rl.refilled(mb, now) < float64(rl.limit.Burst) {
+			continue
+		}
+		rl.evicted.add(mb.stats)
+		delete(rl.mailboxes, key)
+	}
+}
+
+// refilled returns the tokens the mailbox's bucket holds at the given time.
+func (rl *RateLimiter) refilled(mb *mailboxLimiter, now time.Time) float64 {
+	if rl.limit.Requests <= 0 || rl.limit.Window <= 0 {
+		return float64(rl.limit.Burst)
+	}
+	rate := float64(rl.limit.Requests) / rl.limit.Window.Seconds()
+	tokens := mb.tokens + now.Sub(mb.last).Seconds()*rate
+	if tokens > float64(rl.limit.Burst) {
+		tokens = float64(rl.limit.Burst)
+	}
+	return tokens
+}
+
+// reserve takes n tokens from the mailbox's bucket, returning how long the caller must wait before the tokens are actually available.
+func (rl *RateLimiter) reserve(mb *mailboxLimiter, n int) time.Duration {
+	if rl.limit.Requests <= 0 || rl.limit.Window <= 0 {
+		return 0
+	}
+	rate := float64(rl.limit.Requests) / rl.limit.Window.Seconds()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := time.Now()
+	mb.tokens = rl.refilled(mb, now)
+	mb.last = now
+	mb.tokens -= float64(n)
+	if mb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-mb.tokens / rate * float64(time.Second))
+}
@@ -0,0 +1,88 @@
+package outlook
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterEvictsIdleMailboxes(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{Requests: 1000, Window: time.Second, MaxConcurrent: 2})
+	ctx := context.Background()
+
+	release, err := rl.Wait(ctx, "busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		done, err := rl.Wait(ctx, fmt.Sprintf("user%d@contoso.com", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+	}
+
+	// Once their buckets have refilled, the idle mailboxes are evicted when the next new one is tracked
+	time.Sleep(10 * time.Millisecond)
+	rl.mu.Lock()
+	rl.swept = time.Time{}
+	rl.mu.Unlock()
+	done, err := rl.Wait(ctx, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+
+	rl.mu.Lock()
+	tracked := len(rl.mailboxes)
+	_, busy := rl.mailboxes["busy"]
+	rl.mu.Unlock()
+	if tracked != 2 || !busy {
+		t.Errorf("tracking %d mailboxes (busy kept: %v), want only busy and new", tracked, busy)
+	}
+	if total := rl.TotalStats().Requests; total != 102 {
+		t.Errorf("total requests = %d after eviction, want 102", total)
+	}
+	release()
+}
+
+func TestRateLimiterWaitNCountsEveryRequest(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{Requests: 20, Window: time.Hour})
+	ctx := context.Background()
+
+	release, err := rl.WaitN(ctx, "ann", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if got := rl.Stats("ann").Requests; got != 20 {
+		t.Errorf("Stats().Requests = %d, want 20", got)
+	}
+
+	// The bucket is empty, so another request has to wait for a token the context doesn't allow for
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := rl.Wait(timeout, "ann"); err == nil {
+		t.Error("Wait succeeded on an exhausted bucket")
+	}
+}
+
+func TestSessionMailboxKeys(t *testing.T) {
+	client, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ann := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "ann"})
+	bob := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "bob"})
+
+	if ann.Mailbox() != ann.Mailbox() {
+		t.Error("Mailbox changed between calls")
+	}
+	if ann.Mailbox() == bob.Mailbox() {
+		t.Errorf("sessions for different logins share the mailbox key %q", ann.Mailbox())
+	}
+	if got := ann.ForUser("Carol@Contoso.com").Mailbox(); got != "carol@contoso.com" {
+		t.Errorf("ForUser(...).Mailbox() = %q, want carol@contoso.com", got)
+	}
+}
@@ -0,0 +1,184 @@
+package outlook_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	outlook "github.com/amhester/go-outlook"
+	"github.com/amhester/go-outlook/kql"
+	"github.com/amhester/go-outlook/odata"
+	"github.com/amhester/go-outlook/outlooktest"
+)
+
+// replaySession returns a session whose requests are served in order from the golden file testdata/<name>.json, along with the replayer
+// serving them, which fails any request the file doesn't hold. Recorded request bodies have to match as well.
+func replaySession(t *testing.T, name string) (*outlook.Session, *outlooktest.Replayer) {
+	t.Helper()
+	matchers := append(append([]outlooktest.Matcher(nil), outlooktest.DefaultMatchers...), outlooktest.MatchBody)
+	replayer, err := outlooktest.NewReplayer(filepath.Join("testdata", name+".json"), outlooktest.ReplayMatching(matchers...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := outlook.NewMemoryTokenStore()
+	ctx := context.Background()
+	store.Save(ctx, name, &outlook.Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)})
+	client, err := outlook.NewClient(outlook.SetClientHTTPClient(replayer.Client()), outlook.SetClientTokenStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.LoadSession(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session, replayer
+}
+
+// checkReplayed fails the test if any of the golden file's requests weren't made.
+func checkReplayed(t *testing.T, replayer *outlooktest.Replayer) {
+	t.Helper()
+	if remaining := replayer.Remaining(); remaining != 0 {
+		t.Errorf("%d recorded requests were not made", remaining)
+	}
+}
+
+func TestReplayCalendarList(t *testing.T) {
+	session, replayer := replaySession(t, "calendars_list")
+	calendars, err := session.Calendars().List().MaxResults(2).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+
+	var names []string
+	for _, calendar := range calendars {
+		names = append(names, calendar.Name)
+	}
+	if len(names) != 3 || names[0] != "Calendar" || names[2] != "Birthdays" {
+		t.Errorf("got calendars %v, want those of both pages", names)
+	}
+	if owner := calendars[0].Owner; owner == nil || owner.Address != "ann@contoso.com" || !calendars[0].CanEdit {
+		t.Errorf("first calendar decoded as %+v", calendars[0])
+	}
+}
+
+func TestReplayCalendarGet(t *testing.T) {
+	session, replayer := replaySession(t, "calendar_get")
+	ctx := context.Background()
+
+	calendar, err := session.Calendars().Get("AAMkAGI2TGuLAAA=").Select("id", "name", "owner").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.Name != "Calendar" || calendar.ETag != `W/"DwAAABYAAAB+2Yz5"` || calendar.RequestID == "" {
+		t.Errorf("calendar decoded as %+v", calendar)
+	}
+
+	_, err = session.Calendars().Get("AAMkAGI2TGuZAAA=").Do(ctx)
+	var statusErr *outlook.ErrStatusCode
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound || statusErr.ErrorCode != "ErrorItemNotFound" || statusErr.RequestID == "" {
+		t.Errorf("getting a missing calendar failed with %v, want graph's ErrorItemNotFound", err)
+	}
+	checkReplayed(t, replayer)
+}
+
+func TestReplayCalendarCreate(t *testing.T) {
+	session, replayer := replaySession(t, "calendar_create")
+	calendar, err := session.Calendars().Create().Calendar(&outlook.Calendar{Name: "Volunteering"}).Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if calendar.ID != "AAMkAGI2TGuOAAA=" || calendar.HTTPStatusCode != http.StatusCreated {
+		t.Errorf("created calendar is %+v with status %d", calendar, calendar.HTTPStatusCode)
+	}
+}
+
+func TestReplayEventList(t *testing.T) {
+	session, replayer := replaySession(t, "events_list")
+	start := time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)
+	events, err := session.Events().List("primary").StartTime(start).EndTime(start.AddDate(0, 0, 7)).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Subject != "Weekly sync" || events[0].SeriesID == "" || events[0].Start.DateTime != "2024-02-05T15:00:00.0000000" {
+		t.Errorf("first event decoded as %+v", events[0])
+	}
+	if events[1].ShowAs != outlook.EventShowAsOOF {
+		t.Errorf("second event shows as %q, want oof", events[1].ShowAs)
+	}
+}
+
+func TestReplayEventGet(t *testing.T) {
+	session, replayer := replaySession(t, "event_get")
+	event, err := session.Events().Get("AAMkAGI2TGuLAAA=", "AAMkAGI2TG93AAA=").Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if event.Subject != "Weekly sync" || len(event.Attendees) != 1 || event.Organizer.EmailAddress.Address != "ann@contoso.com" {
+		t.Errorf("event decoded as %+v", event)
+	}
+}
+
+func TestReplayEventCreate(t *testing.T) {
+	session, replayer := replaySession(t, "event_create")
+	event, err := session.Events().Create("AAMkAGI2TGuLAAA=").Event(&outlook.Event{
+		Subject: "Lunch with Bob",
+		Start:   &outlook.DateTimeTimeZone{DateTime: "2024-02-06T12:00:00", Timezone: "UTC"},
+		End:     &outlook.DateTimeTimeZone{DateTime: "2024-02-06T13:00:00", Timezone: "UTC"},
+	}).Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if event.ID != "AAMkAGI2TG95AAA=" || event.WebLink == "" || event.HTTPStatusCode != http.StatusCreated {
+		t.Errorf("created event is %+v", event)
+	}
+}
+
+func TestReplayFolderList(t *testing.T) {
+	session, replayer := replaySession(t, "folders_list")
+	folders, err := session.Folders().List().All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if len(folders) != 3 || folders[1].DisplayName != "Inbox" || folders[1].UnreadItemCount != 3 {
+		t.Errorf("got folders %+v", folders)
+	}
+}
+
+func TestReplayMessageList(t *testing.T) {
+	session, replayer := replaySession(t, "messages_list")
+	messages, err := session.Messages().List("inbox").
+		Filter(odata.Field("isRead").Eq(false)).
+		StartTime(time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)).
+		All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if len(messages) != 2 || messages[0].Subject != "Weekly report" || !messages[0].HasAttachments || messages[1].From.EmailAddress.Address != "carol@fabrikam.com" {
+		t.Errorf("got messages %+v", messages)
+	}
+}
+
+func TestReplayMessageSearch(t *testing.T) {
+	session, replayer := replaySession(t, "messages_search")
+	messages, err := session.Messages().Search(kql.And(kql.From("bob"), kql.Subject("weekly report"))).MaxResults(1).All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplayed(t, replayer)
+	if len(messages) != 2 || messages[1].BodyPreview != "Flat this week" {
+		t.Errorf("got messages %+v, want those of both pages", messages)
+	}
+}
@@ -0,0 +1,141 @@
+package outlook
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries requests which failed with a throttling or transient server error.
+type RetryPolicy struct {
+	// MaxAttempts the total number of attempts made for a request, including the first. Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay the delay before the first retry, doubled for every retry after it.
+	BaseDelay time.Duration
+	// MaxDelay the cap on the delay between attempts. A request whose Retry-After asks for longer is not retried, and its error is returned instead.
+	MaxDelay time.Duration
+	// RetryStatuses the status codes which are retried. Defaults to 429, 503 and 504 when empty.
+	RetryStatuses []int
+	// RetryNonIdempotent also retries POST and PATCH requests, which may then be applied more than once.
+	RetryNonIdempotent bool
+	// IgnoreRetryAfter always waits the computed delay, rather than the duration suggested by microsoft's Retry-After header.
+	IgnoreRetryAfter bool
+}
+
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy returns a new copy of the retry policy clients use unless configured otherwise, which can be changed without affecting other clients.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+// SetClientRetryPolicy returns a ClientOpt function which sets the client's retry policy. A nil policy disables retries.
+func SetClientRetryPolicy(policy *RetryPolicy) ClientOpt {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// SetRetryPolicy fluent configuration of the client's retry policy. A nil policy disables retries.
+func (client *Client) SetRetryPolicy(policy *RetryPolicy) *Client {
+	client.retryPolicy = policy
+	return client
+}
+
+// retryDelay returns how long to wait before making another attempt at req, which failed with err on the given attempt, or false if it shouldn't be retried.
+func (policy *RetryPolicy) retryDelay(req *http.Request, attempt int, err error) (time.Duration, bool) {
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return 0, false
+	}
+	statusErr, ok := err.(*ErrStatusCode)
+	if !ok || !policy.retriesStatus(statusErr.Code) {
+		return 0, false
+	}
+	if !policy.RetryNonIdempotent && !isIdempotent(req.Method) {
+		return 0, false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body has already been read and can't be replayed
+		return 0, false
+	}
+
+	if statusErr.SuggestedRetryDuration > 0 && !policy.IgnoreRetryAfter {
+		// Waiting less than microsoft asked for would only be throttled again, so a wait beyond the cap is left to the caller
+		if policy.MaxDelay > 0 && statusErr.SuggestedRetryDuration > policy.MaxDelay {
+			return 0, false
+		}
+		return statusErr.SuggestedRetryDuration, true
+	}
+	return policy.backoff(attempt), true
+}
+
+func (policy *RetryPolicy) retriesStatus(code int) bool {
+	statuses := policy.RetryStatuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	for _, status := range statuses {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the exponential delay for the given attempt with half of it randomly jittered, so that throttled callers spread out their retries.
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempt && (policy.MaxDelay <= 0 || delay < policy.MaxDelay); i++ {
+		delay *= 2
+	}
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// rewindBody resets the body of req so that it can be sent again.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+// sleepContext waits for the given duration, returning early with the context's error if it is done first.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
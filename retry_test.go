@@ -0,0 +1,192 @@
+package outlook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 10 * time.Second}
+	throttled := func(retryAfter time.Duration) error {
+		return &ErrStatusCode{Code: http.StatusTooManyRequests, SuggestedRetryDuration: retryAfter}
+	}
+
+	tests := []struct {
+		name      string
+		policy    *RetryPolicy
+		method    string
+		attempt   int
+		err       error
+		wantRetry bool
+		wantDelay time.Duration
+	}{
+		{name: "retry after", policy: policy, method: http.MethodGet, attempt: 1, err: throttled(2 * time.Second), wantRetry: true, wantDelay: 2 * time.Second},
+		{name: "retry after beyond max delay", policy: policy, method: http.MethodGet, attempt: 1, err: throttled(time.Minute)},
+		{name: "last attempt", policy: policy, method: http.MethodGet, attempt: 3, err: throttled(time.Second)},
+		{name: "nil policy", method: http.MethodGet, attempt: 1, err: throttled(time.Second)},
+		{name: "not retried status", policy: policy, method: http.MethodGet, attempt: 1, err: &ErrStatusCode{Code: http.StatusInternalServerError}},
+		{name: "not a status error", policy: policy, method: http.MethodGet, attempt: 1, err: errors.New("connection reset")},
+		{name: "post", policy: policy, method: http.MethodPost, attempt: 1, err: throttled(time.Second)},
+		{name: "patch", policy: policy, method: http.MethodPatch, attempt: 1, err: throttled(time.Second)},
+		{name: "delete", policy: policy, method: http.MethodDelete, attempt: 1, err: throttled(time.Second), wantRetry: true, wantDelay: time.Second},
+		{
+			name:      "post retried non-idempotent",
+			policy:    &RetryPolicy{MaxAttempts: 3, MaxDelay: 10 * time.Second, RetryNonIdempotent: true},
+			method:    http.MethodPost,
+			attempt:   1,
+			err:       throttled(time.Second),
+			wantRetry: true,
+			wantDelay: time.Second,
+		},
+		{
+			name:      "custom statuses",
+			policy:    &RetryPolicy{MaxAttempts: 3, RetryStatuses: []int{http.StatusInternalServerError}},
+			method:    http.MethodGet,
+			attempt:   1,
+			err:       &ErrStatusCode{Code: http.StatusInternalServerError, SuggestedRetryDuration: time.Second},
+			wantRetry: true,
+			wantDelay: time.Second,
+		},
+		{
+			name:    "custom statuses leave out 429",
+			policy:  &RetryPolicy{MaxAttempts: 3, RetryStatuses: []int{http.StatusInternalServerError}},
+			method:  http.MethodGet,
+			attempt: 1,
+			err:     throttled(time.Second),
+		},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "https://graph.microsoft.com/v1.0/me/events", nil)
+		delay, retry := tt.policy.retryDelay(req, tt.attempt, tt.err)
+		if retry != tt.wantRetry || delay != tt.wantDelay {
+			t.Errorf("%s: retryDelay() = %v, %v, want %v, %v", tt.name, delay, retry, tt.wantDelay, tt.wantRetry)
+		}
+	}
+}
+
+func TestRetryDelayIgnoreRetryAfter(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, IgnoreRetryAfter: true}
+	req, _ := http.NewRequest(http.MethodGet, "https://graph.microsoft.com/v1.0/me/events", nil)
+	// The backoff is used instead, even when microsoft asks for more than MaxDelay
+	for _, retryAfter := range []time.Duration{5 * time.Second, time.Minute} {
+		delay, retry := policy.retryDelay(req, 1, &ErrStatusCode{Code: http.StatusTooManyRequests, SuggestedRetryDuration: retryAfter})
+		if !retry || delay < 50*time.Millisecond || delay > 100*time.Millisecond {
+			t.Errorf("retryDelay() with a Retry-After of %v = %v, %v, want the first backoff", retryAfter, delay, retry)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 100; i++ {
+			if delay := policy.backoff(attempt); delay < want/2 || delay > want {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", attempt, delay, want/2, want)
+			}
+		}
+	}
+	if delay := (&RetryPolicy{}).backoff(1); delay != 0 {
+		t.Errorf("backoff() without a base delay = %v, want 0", delay)
+	}
+}
+
+// flakyServer fails the first failures requests it receives with a 503 asking for a retry after retryAfter, recording the body of every request.
+func flakyServer(failures int, retryAfter string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		failed := len(bodies) <= failures
+		mu.Unlock()
+		w.Header().Set("Content-Type", mediaType)
+		if failed {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":"ServiceUnavailable","message":"try later"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"created"}`))
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestClientRetryRewindsBody(t *testing.T) {
+	server, bodies := flakyServer(2, "0")
+	defer server.Close()
+	client, err := NewClient(
+		SetClientGraphHost(server.URL),
+		SetClientRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryNonIdempotent: true}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	req, err := client.NewRequest(ctx, http.MethodPost, "/me/calendars", &Calendar{Name: "Team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created Calendar
+	if _, err := client.Do(ctx, req, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "created" {
+		t.Errorf("decoded %+v", created)
+	}
+
+	got := bodies()
+	if len(got) != 3 {
+		t.Fatalf("made %d attempts, want 3", len(got))
+	}
+	for i, body := range got {
+		if !strings.Contains(body, `"name":"Team"`) {
+			t.Errorf("attempt %d sent body %q, want the calendar each time", i+1, body)
+		}
+	}
+}
+
+func TestClientRetryStopsWhenContextDone(t *testing.T) {
+	server, bodies := flakyServer(1, "20")
+	defer server.Close()
+	client, err := NewClient(SetClientGraphHost(server.URL), SetClientRetryPolicy(&RetryPolicy{MaxAttempts: 3, MaxDelay: time.Minute}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := client.NewRequest(ctx, http.MethodGet, "/me/calendars", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = client.Do(ctx, req, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Do() error = %v, want the context's error while waiting to retry", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Do() returned after %v, want it to stop waiting once the context was done", elapsed)
+	}
+	if got := len(bodies()); got != 1 {
+		t.Errorf("made %d attempts, want 1", got)
+	}
+}
@@ -2,75 +2,344 @@ package outlook
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Session manages communication to microsoft's graph api as an authenticated user.
+// A Session is safe for concurrent use by multiple goroutines, which share a single access token and wait on a single in-flight refresh of it.
 type Session struct {
-	client       *Client
-	basePath     string
+	client    *Client
+	requester Requester
+	basePath  string
+	user      string
+	grantType string
+	tenantID  string
+	auth      *sessionAuth
+}
+
+// sessionAuth the token state of a session, shared between a session and the copies of it made by ForUser.
+type sessionAuth struct {
+	mu           sync.Mutex
 	accessToken  string
 	refreshToken string
+	expiresAt    time.Time
+	storeKey     string
+	refreshing   chan struct{}
+	refreshErr   error
+	id           uint64
 }
 
+// sessionAuthIDs the last id given to a sessionAuth, which tells apart the mailboxes of sessions signed in as different users.
+var sessionAuthIDs uint64
+
+func (auth *sessionAuth) token() *Token {
+	return &Token{
+		AccessToken:  auth.accessToken,
+		RefreshToken: auth.refreshToken,
+		Expiry:       auth.expiresAt,
+	}
+}
+
+// tokenExpiryLeeway how long before an access token expires that the session will proactively refresh it.
+const tokenExpiryLeeway = 2 * time.Minute
+
+// tokenRefreshTimeout how long a refresh of the access token may take, as it doesn't end with the context of the request which started it.
+const tokenRefreshTimeout = 30 * time.Second
+
+const (
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
 // NewSession returns a new instance of a Session.
 func NewSession(client *Client, refreshToken string) (*Session, error) {
 	session := &Session{
-		client:       client,
-		basePath:     "/me",
-		refreshToken: refreshToken,
+		client:    client,
+		basePath:  "/me",
+		grantType: grantTypeRefreshToken,
+		tenantID:  client.tenantID,
+		auth:      &sessionAuth{refreshToken: refreshToken},
 	}
 
-	if err := session.refreshAccessToken(); err != nil {
+	if err := session.refreshAccessToken(context.Background(), ""); err != nil {
 		return nil, err
 	}
 
 	return session, nil
 }
 
-func (session *Session) query(ctx context.Context, method, url string, params map[string]interface{}, data interface{}, result interface{}) (*http.Response, error) {
+// NewAppSession returns a new instance of an app-only Session authenticated with the client_credentials grant for the given tenant.
+// If tenantID is empty the client's tenant is used, which must then be a specific tenant rather than one of the multi-tenant aliases.
+func NewAppSession(ctx context.Context, client *Client, tenantID string) (*Session, error) {
+	if tenantID == "" {
+		tenantID = client.tenantID
+	}
+	if tenantID == "" || isMultiTenant(tenantID) {
+		return nil, ErrNoTenantID
+	}
+
+	session := &Session{
+		client:    client,
+		basePath:  "/me",
+		grantType: grantTypeClientCredentials,
+		tenantID:  tenantID,
+		auth:      &sessionAuth{},
+	}
+
+	if err := session.refreshAccessToken(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// NewSessionOnBehalfOf returns a new instance of a Session for the user who the given access token was issued to, using the on-behalf-of grant.
+// This lets an api which was called with a user's bearer token call microsoft's graph api as that user. The client's scope should include
+// offline_access so that the grant returns a refresh token, which the session then keeps refreshing itself from.
+func NewSessionOnBehalfOf(ctx context.Context, client *Client, userAssertion string) (*Session, error) {
+	tokenURL := client.authorityURL(client.tenantID, "token")
+	body := url.Values{}
+	body.Set("client_id", client.appID)
+	if err := client.authenticate(body, tokenURL); err != nil {
+		return nil, err
+	}
+	body.Set("grant_type", grantTypeJWTBearer)
+	body.Set("requested_token_use", "on_behalf_of")
+	body.Set("assertion", userAssertion)
+	body.Set("scope", client.scope)
+
+	tokenRes, err := client.requestToken(ctx, tokenURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSessionFromToken(client, tokenRes), nil
+}
+
+// newSessionFromToken returns a new instance of a Session for tokens which have already been issued, so no refresh is needed.
+func newSessionFromToken(client *Client, tokenRes *RefreshTokenResponse) *Session {
+	return &Session{
+		client:    client,
+		basePath:  "/me",
+		grantType: grantTypeRefreshToken,
+		tenantID:  client.tenantID,
+		auth: &sessionAuth{
+			accessToken:  tokenRes.AccessToken,
+			refreshToken: tokenRes.RefreshToken,
+			expiresAt:    tokenExpiry(tokenRes),
+		},
+	}
+}
+
+// NewRequesterSession returns a new instance of a Session which sends its requests through the given Requester rather than a Client,
+// e.g. an outlookmock.Requester in tests. Paths reach the requester relative to the mailbox, or prefixed with /users/{id} for copies
+// made by ForUser, and batches are executed one item at a time.
+func NewRequesterSession(requester Requester) *Session {
+	return &Session{
+		requester: requester,
+		auth:      &sessionAuth{},
+	}
+}
+
+// Persist saves the session's tokens under key in the client's TokenStore and keeps them saved there whenever they change.
+// Client.LoadSession can then rebuild the session with the same key.
+func (session *Session) Persist(ctx context.Context, key string) error {
+	if session.client == nil || session.client.tokenStore == nil {
+		return ErrNoTokenStore
+	}
+	session.auth.mu.Lock()
+	session.auth.storeKey = key
+	token := session.auth.token()
+	session.auth.mu.Unlock()
+	return session.saveToken(ctx, key, token)
+}
+
+// ForUser returns a copy of the session which targets the mailbox of the given user id or userPrincipalName instead of the signed in user.
+// This is required for app-only sessions, but can also be used by delegated sessions to access mailboxes shared with the signed in user.
+// The copy shares its tokens with the original session.
+func (session *Session) ForUser(userIDOrUPN string) *Session {
+	userSession := *session
+	userSession.basePath = fmt.Sprintf("/users/%s", url.PathEscape(userIDOrUPN))
+	userSession.user = userIDOrUPN
+	return &userSession
+}
+
+// Query performs a request of any method to microsofts api with the given query parameters and headers, such as If-Match, along with the sessions accessToken for authorization.
+// This is how the calls built by the services send their requests.
+func (session *Session) Query(ctx context.Context, method, url string, params url.Values, header http.Header, data interface{}, result interface{}) (*http.Response, error) {
+	if session.requester != nil {
+		if !isAbsoluteURL(url) {
+			url = session.basePath + url
+		}
+		return session.requester.Query(ctx, method, url, params, header, data, result)
+	}
+
+	path, err := session.requestPath(url, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.queryPath(ctx, method, path, header, 1, data, result)
+}
+
+// requestPath returns the path relative to the api's root of a request to a path relative to the session's base path.
+// Absolute links returned by graph, such as @odata.nextLink, already carry their mailbox and query, so they are followed verbatim.
+func (session *Session) requestPath(path string, params url.Values) (string, error) {
+	if isAbsoluteURL(path) {
+		return session.client.apiPath(path)
+	}
+
 	var queryString string
 	if params != nil {
 		queryString = createQueryString(params)
 	}
 
-	path := fmt.Sprintf("%s%s%s", session.basePath, url, queryString)
+	return fmt.Sprintf("%s%s%s", session.basePath, path, queryString), nil
+}
+
+// queryPath performs a request to the given path, which is relative to the api's root rather than the session's base path.
+// Graph counts the request as the given number of requests against the mailbox's limits, which is more than one for a $batch.
+func (session *Session) queryPath(ctx context.Context, method, path string, header http.Header, requests int, data interface{}, result interface{}) (*http.Response, error) {
+	accessToken, err := session.ensureAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := session.send(ctx, method, path, header, accessToken, requests, data, result)
+	if errors.Is(err, ErrUnauthorized) && session.canRefresh() {
+		// The token may have been revoked or expired early, so refresh it once and replay the request
+		if refreshErr := session.refreshAccessToken(ctx, accessToken); refreshErr != nil {
+			return res, refreshErr
+		}
+		if accessToken, err = session.ensureAccessToken(ctx); err != nil {
+			return nil, err
+		}
+		return session.send(ctx, method, path, header, accessToken, requests, data, result)
+	}
 
+	return res, err
+}
+
+func (session *Session) send(ctx context.Context, method, path string, header http.Header, accessToken string, requests int, data interface{}, result interface{}) (*http.Response, error) {
+	// The token is attached by the bearerAuth middleware at the top of the client's transport
+	ctx = withAccessToken(ctx, accessToken)
 	req, err := session.client.NewRequest(ctx, method, path, data)
 	if err != nil {
 		return nil, err
 	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return session.client.doLimited(ctx, req, result, session.Mailbox(), requests)
+}
+
+// Mailbox returns the key the session's requests are rate limited and counted under by the client's RateLimiter, e.g. for RateLimiter.Stats.
+// It is the lowercased user id or userPrincipalName given to ForUser, or for the signed in user's own mailbox, me followed by a number
+// identifying the login, as sessions for different users all reach their mailboxes through /me. Copies made by ForUser share that number.
+func (session *Session) Mailbox() string {
+	if session.user != "" {
+		return strings.ToLower(session.user)
+	}
+	session.auth.mu.Lock()
+	defer session.auth.mu.Unlock()
+	if session.auth.id == 0 {
+		session.auth.id = atomic.AddUint64(&sessionAuthIDs, 1)
+	}
+	return fmt.Sprintf("me#%d", session.auth.id)
+}
+
+// ensureAccessToken returns the session's access token, refreshing it first if it is missing or about to expire.
+func (session *Session) ensureAccessToken(ctx context.Context) (string, error) {
+	session.auth.mu.Lock()
+	accessToken := session.auth.accessToken
+	expiresAt := session.auth.expiresAt
+	session.auth.mu.Unlock()
 
-	if session.accessToken == "" {
-		return nil, ErrNoAccessToken
+	expiring := !expiresAt.IsZero() && time.Now().Add(tokenExpiryLeeway).After(expiresAt)
+	if accessToken != "" && !expiring {
+		return accessToken, nil
 	}
+	if !session.canRefresh() {
+		if accessToken == "" {
+			return "", ErrNoAccessToken
+		}
+		return accessToken, nil
+	}
+	if err := session.refreshAccessToken(ctx, accessToken); err != nil {
+		return "", err
+	}
+
+	session.auth.mu.Lock()
+	defer session.auth.mu.Unlock()
+	if session.auth.accessToken == "" {
+		return "", ErrNoAccessToken
+	}
+	return session.auth.accessToken, nil
+}
+
+// canRefresh reports whether the session holds what it needs to fetch a new access token.
+func (session *Session) canRefresh() bool {
+	if session.grantType == grantTypeClientCredentials {
+		return true
+	}
+	session.auth.mu.Lock()
+	defer session.auth.mu.Unlock()
+	return session.auth.refreshToken != ""
+}
+
+// callRequest the description of a single request to microsoft's graph api, built by a call so that it can either be executed on its own or queued in a batch.
+type callRequest struct {
+	method string
+	path   string
+	params url.Values
+	header http.Header
+	body   interface{}
+	result interface{}
+}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", session.accessToken))
+// ifMatchHeader returns the header making a request conditional on the given etag, or nil if there is none.
+func ifMatchHeader(etag string) http.Header {
+	if etag == "" {
+		return nil
+	}
+	return http.Header{"If-Match": []string{etag}}
+}
 
-	// May want to detect failures due to invalid or expired tokens, then retry after attempting to refresh the token
-	return session.client.Do(ctx, req, result)
+func (req *callRequest) do(ctx context.Context, requester Requester) (*http.Response, error) {
+	res, err := requester.Query(ctx, req.method, req.path, req.params, req.header, req.body, req.result)
+	if setter, ok := req.result.(serverResponseSetter); ok && err == nil && res != nil {
+		setter.setServerResponse(res.StatusCode, res.Header)
+	}
+	return res, err
 }
 
 // Get performs a get request to microsofts api with the underlying client and the sessions accessToken for authorization.
 func (session *Session) Get(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
-	return session.query(ctx, http.MethodGet, url, params, nil, result)
+	return session.Query(ctx, http.MethodGet, url, queryValues(params), nil, nil, result)
 }
 
 // Post performs a post request to microsofts api with the underlying client and the sessions accessToken for authorization.
 func (session *Session) Post(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
-	return session.query(ctx, http.MethodPost, url, nil, data, result)
+	return session.Query(ctx, http.MethodPost, url, nil, nil, data, result)
 }
 
 // Patch performs a patch request to microsofts api with the underlying client and the sessions accessToken for authorization.
 func (session *Session) Patch(ctx context.Context, url string, data interface{}, result interface{}) (*http.Response, error) {
-	return session.query(ctx, http.MethodPatch, url, nil, data, result)
+	return session.Query(ctx, http.MethodPatch, url, nil, nil, data, result)
 }
 
 // Delete performs a delete request to microsofts api with the underlying client and the sessions accessToken for authorization.
 func (session *Session) Delete(ctx context.Context, url string, params map[string]interface{}, result interface{}) (*http.Response, error) {
-	return session.query(ctx, http.MethodDelete, url, params, nil, result)
+	return session.Query(ctx, http.MethodDelete, url, queryValues(params), nil, nil, result)
 }
 
 // Calendars returns an instance of a CalendarService using this session.
@@ -93,31 +362,99 @@ func (session *Session) Messages() *MessageService {
 	return NewMessageService(session)
 }
 
-func (session *Session) refreshAccessToken() error {
-	body := url.Values{}
-	body.Set("client_id", session.client.appID)
-	body.Set("client_secret", session.client.appSecret)
-	body.Set("refresh_token", session.refreshToken)
-	body.Set("redirect_uri", session.client.redirectURI)
-	body.Set("scope", session.client.scope)
-	body.Set("grant_type", "refresh_token")
+// refreshAccessToken fetches a new access token for the session. Concurrent callers wait on the same in-flight refresh rather than each hitting the token endpoint.
+// If stale is set and the session's access token has already moved on from it, another caller has refreshed in the meantime and nothing is fetched.
+// The refresh itself runs detached from ctx, so a caller giving up on it doesn't fail the refresh for the others waiting on it.
+func (session *Session) refreshAccessToken(ctx context.Context, stale string) error {
+	auth := session.auth
+	auth.mu.Lock()
+	if stale != "" && auth.accessToken != stale {
+		auth.mu.Unlock()
+		return nil
+	}
+	wait := auth.refreshing
+	if wait == nil {
+		wait = make(chan struct{})
+		auth.refreshing = wait
+		go session.runRefresh(context.WithoutCancel(ctx), auth.refreshToken, wait)
+	}
+	auth.mu.Unlock()
+
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	return auth.refreshErr
+}
 
-	// I suppose it's possible for this to change the media type of other requests being made at essentially the same time, will update sometime
-	session.client.SetMediaType("application/x-www-form-urlencoded")
+// runRefresh fetches a new access token and saves it, within tokenRefreshTimeout, then closes done to release the callers waiting on it.
+func (session *Session) runRefresh(ctx context.Context, refreshToken string, done chan struct{}) {
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+	auth := session.auth
 
-	req, err := session.client.NewRequest(context.Background(), http.MethodPost, DefaultOAuthTokenURL, body)
-	if err != nil {
-		return err
+	tokenRes, err := session.fetchToken(ctx, refreshToken)
+
+	auth.mu.Lock()
+	if err == nil {
+		auth.accessToken = tokenRes.AccessToken
+		auth.expiresAt = tokenExpiry(tokenRes)
+		// Microsoft rotates refresh tokens, so the newest one has to be kept around or the stored one eventually goes stale
+		if tokenRes.RefreshToken != "" {
+			auth.refreshToken = tokenRes.RefreshToken
+		}
 	}
+	storeKey := auth.storeKey
+	token := auth.token()
+	auth.mu.Unlock()
 
-	session.client.SetMediaType(mediaType)
+	if err == nil && storeKey != "" && session.client.tokenStore != nil {
+		err = session.saveToken(ctx, storeKey, token)
+	}
+
+	auth.mu.Lock()
+	auth.refreshErr = err
+	auth.refreshing = nil
+	auth.mu.Unlock()
+	close(done)
+}
 
-	var tokenRes RefreshTokenResponse
-	if _, err := session.client.Do(context.Background(), req, &tokenRes); err != nil {
-		return err
+// fetchToken requests a new access token from microsoft using the session's grant.
+func (session *Session) fetchToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error) {
+	tokenURL := session.client.authorityURL(session.tenantID, "token")
+	body := url.Values{}
+	body.Set("client_id", session.client.appID)
+	if err := session.client.authenticate(body, tokenURL); err != nil {
+		return nil, err
 	}
+	body.Set("grant_type", session.grantType)
 
-	session.accessToken = tokenRes.AccessToken
+	switch session.grantType {
+	case grantTypeClientCredentials:
+		body.Set("scope", session.client.appScope())
+	default:
+		body.Set("refresh_token", refreshToken)
+		body.Set("redirect_uri", session.client.redirectURI)
+		body.Set("scope", session.client.scope)
+	}
 
+	return session.client.requestToken(ctx, tokenURL, body)
+}
+
+func (session *Session) saveToken(ctx context.Context, key string, token *Token) error {
+	if err := session.client.tokenStore.Save(ctx, key, token); err != nil {
+		return fmt.Errorf("failed to save session tokens: %v", err)
+	}
 	return nil
 }
+
+// tokenExpiry returns the time at which the access token of the given response expires, or the zero time if microsoft didn't say.
+func tokenExpiry(tokenRes *RefreshTokenResponse) time.Time {
+	if tokenRes.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(tokenRes.ExpiresIn) * time.Second)
+}
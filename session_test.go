@@ -0,0 +1,329 @@
+package outlook_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	outlook "github.com/amhester/go-outlook"
+	"github.com/amhester/go-outlook/outlooktest"
+)
+
+// tokenRequests returns the number of requests the server has received at its token endpoint.
+func tokenRequests(server *outlooktest.Server) int {
+	count := 0
+	for _, req := range server.Requests() {
+		if strings.Contains(req.URL, "/oauth2/v2.0/token") {
+			count++
+		}
+	}
+	return count
+}
+
+// tokenForms returns the urls and redacted forms of the requests the server has received at its token endpoint.
+func tokenForms(server *outlooktest.Server) ([]string, []url.Values) {
+	var urls []string
+	var forms []url.Values
+	for _, req := range server.Requests() {
+		if strings.Contains(req.URL, "/oauth2/v2.0/token") {
+			form, _ := url.ParseQuery(req.Body)
+			urls = append(urls, req.URL)
+			forms = append(forms, form)
+		}
+	}
+	return urls, forms
+}
+
+// expiredSession returns a session for the server whose access token has expired, loaded from a token store.
+func expiredSession(t *testing.T, server *outlooktest.Server, opts ...outlook.ClientOpt) *outlook.Session {
+	t.Helper()
+	store := outlook.NewMemoryTokenStore()
+	ctx := context.Background()
+	store.Save(ctx, "ann", &outlook.Token{AccessToken: "expired", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Minute)})
+	client, err := server.NewClient(append(opts, outlook.SetClientAppID("app"), outlook.SetClientAppSecret("secret"), outlook.SetClientTokenStore(store))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.LoadSession(ctx, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestSessionRefreshesExpiredTokenOnce(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	session := expiredSession(t, server)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := session.Calendars().List().Do(context.Background())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := tokenRequests(server); got != 1 {
+		t.Errorf("%d concurrent queries made %d token requests, want 1", n, got)
+	}
+}
+
+func TestSessionRefreshOutlivesCancelledCaller(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	holdTokenRequests := func(next http.RoundTripper) http.RoundTripper {
+		return outlook.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, "/token") {
+				started <- struct{}{}
+				select {
+				case <-release:
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	session := expiredSession(t, server, outlook.SetClientMiddleware(holdTokenRequests))
+
+	// The first caller starts the refresh, then gives up on it while the token request is held
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := session.Calendars().List().Do(ctx)
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		_, err := session.Calendars().List().Do(context.Background())
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("waiting caller failed with %v after the first gave up", err)
+	}
+	if got := tokenRequests(server); got != 1 {
+		t.Errorf("made %d token requests, want 1", got)
+	}
+}
+
+func TestSessionPersistsRotatedRefreshToken(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	ctx := context.Background()
+	client, err := server.NewClient(outlook.SetClientAppID("app"), outlook.SetClientTokenStore(outlook.NewFileTokenStore(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.NewSession("refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Persist(ctx, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	persisted, err := outlook.NewFileTokenStore(path).Load(ctx, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh rotates the refresh token, which has to reach the store
+	server.ExpireTokens()
+	if _, err := session.Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := outlook.NewFileTokenStore(path).Load(ctx, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == persisted.RefreshToken || rotated.AccessToken == persisted.AccessToken {
+		t.Errorf("stored tokens %+v after the refresh, want them rotated from %+v", rotated, persisted)
+	}
+
+	// A session loaded in another process starts from the rotated tokens and keeps saving under the same key
+	loaded, err := client.LoadSession(ctx, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Calendars().List().Do(ctx); err != nil {
+		t.Errorf("loaded session failed with %v", err)
+	}
+	server.ExpireTokens()
+	if _, err := loaded.Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := outlook.NewFileTokenStore(path).Load(ctx, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.RefreshToken == rotated.RefreshToken {
+		t.Errorf("loaded session didn't save its rotated refresh token %q", reloaded.RefreshToken)
+	}
+	if got := tokenRequests(server); got != 3 {
+		t.Errorf("made %d token requests, want the sign in and two refreshes", got)
+	}
+}
+
+func TestAppSession(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	client, err := server.NewClient(outlook.SetClientAppID("app"), outlook.SetClientAppSecret("secret"), outlook.SetClientTenant("contoso.onmicrosoft.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := client.NewAppSession(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.ForUser("ann@contoso.com").Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// App-only sessions have no refresh token, so they ask for another token with their client credentials
+	server.ExpireTokens()
+	if _, err := session.ForUser("ann@contoso.com").Calendars().List().Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	urls, forms := tokenForms(server)
+	if len(forms) != 2 {
+		t.Fatalf("made %d token requests, want the first token and one after it expired", len(forms))
+	}
+	for i, form := range forms {
+		if !strings.HasPrefix(urls[i], "/contoso.onmicrosoft.com/oauth2/v2.0/token") {
+			t.Errorf("token request %d went to %s, want the client's tenant", i+1, urls[i])
+		}
+		want := url.Values{
+			"client_id":     {"app"},
+			"client_secret": {outlooktest.Redacted},
+			"grant_type":    {"client_credentials"},
+			"scope":         {server.URL + "/.default"},
+		}
+		if form.Encode() != want.Encode() {
+			t.Errorf("token request %d sent %s, want %s", i+1, form.Encode(), want.Encode())
+		}
+	}
+
+	// A tenant given to NewAppSession wins over the client's
+	if _, err := client.NewAppSession(ctx, "fabrikam.onmicrosoft.com"); err != nil {
+		t.Fatal(err)
+	}
+	if urls, _ := tokenForms(server); !strings.HasPrefix(urls[len(urls)-1], "/fabrikam.onmicrosoft.com/") {
+		t.Errorf("token request went to %s, want the given tenant", urls[len(urls)-1])
+	}
+}
+
+func TestAppSessionRequiresTenant(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, tenant := range []string{"", "common", "organizations", "Consumers"} {
+		client, err := server.NewClient(outlook.SetClientAppID("app"), outlook.SetClientAppSecret("secret"), outlook.SetClientTenant(tenant))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.NewAppSession(ctx, ""); !errors.Is(err, outlook.ErrNoTenantID) {
+			t.Errorf("app session for the client tenant %q failed with %v, want ErrNoTenantID", tenant, err)
+		}
+		if _, err := client.NewAppSession(ctx, tenant); !errors.Is(err, outlook.ErrNoTenantID) {
+			t.Errorf("app session for tenant %q failed with %v, want ErrNoTenantID", tenant, err)
+		}
+	}
+	if got := tokenRequests(server); got != 0 {
+		t.Errorf("made %d token requests without a tenant, want none", got)
+	}
+}
+
+func TestSessionOnBehalfOf(t *testing.T) {
+	server := outlooktest.NewServer()
+	defer server.Close()
+	ctx := context.Background()
+	// The server redacts the user's token, so the assertion sent is read before it gets there
+	var assertions []string
+	readAssertion := func(next http.RoundTripper) http.RoundTripper {
+		return outlook.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, "/token") {
+				body, _ := req.GetBody()
+				data, _ := ioutil.ReadAll(body)
+				form, _ := url.ParseQuery(string(data))
+				assertions = append(assertions, form.Get("assertion"))
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	client, err := server.NewClient(
+		outlook.SetClientMiddleware(readAssertion),
+		outlook.SetClientAppID("api"),
+		outlook.SetClientAppSecret("secret"),
+		outlook.SetClientTenant("contoso.onmicrosoft.com"),
+		outlook.SetClientScope("https://graph.microsoft.com/mail.read offline_access"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := client.NewSessionOnBehalfOf(ctx, "user-access-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Messages().List("inbox").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The refresh token the grant returned keeps the session going once the first access token expires
+	server.ExpireTokens()
+	if _, err := session.Messages().List("inbox").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	urls, forms := tokenForms(server)
+	if len(forms) != 2 {
+		t.Fatalf("made %d token requests, want the exchange and one refresh", len(forms))
+	}
+	want := url.Values{
+		"client_id":           {"api"},
+		"client_secret":       {outlooktest.Redacted},
+		"grant_type":          {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"requested_token_use": {"on_behalf_of"},
+		"assertion":           {outlooktest.Redacted},
+		"scope":               {"https://graph.microsoft.com/mail.read offline_access"},
+	}
+	if !strings.HasPrefix(urls[0], "/contoso.onmicrosoft.com/oauth2/v2.0/token") || forms[0].Encode() != want.Encode() {
+		t.Errorf("exchange sent %s to %s, want %s", forms[0].Encode(), urls[0], want.Encode())
+	}
+	if forms[1].Get("grant_type") != "refresh_token" || forms[1].Get("refresh_token") != outlooktest.Redacted {
+		t.Errorf("refresh sent %s, want the refresh_token grant", forms[1].Encode())
+	}
+	if len(assertions) != 2 || assertions[0] != "user-access-token" || assertions[1] != "" {
+		t.Errorf("token requests asserted %q, want the user's token on the exchange only", assertions)
+	}
+}
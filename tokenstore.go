@@ -0,0 +1,144 @@
+package outlook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenNotFound is returned by a TokenStore when it holds no tokens for the given key.
+	ErrTokenNotFound = fmt.Errorf("no tokens stored for key")
+	// ErrNoTokenStore is returned when tokens are persisted or loaded through a client which has no TokenStore configured.
+	ErrNoTokenStore = fmt.Errorf("no token store configured on client")
+)
+
+// Token the set of tokens held by a session, as saved to and loaded from a TokenStore.
+type Token struct {
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// TokenStore persists the tokens of sessions, keyed by user, so that sessions can be rebuilt across process restarts.
+// Save is called by a session whenever its tokens change, which includes microsoft rotating the refresh token.
+type TokenStore interface {
+	Load(ctx context.Context, key string) (*Token, error)
+	Save(ctx context.Context, key string, token *Token) error
+}
+
+// MemoryTokenStore a TokenStore which keeps tokens in memory for the life of the process.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]Token
+}
+
+// NewMemoryTokenStore returns a new instance of a MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: map[string]Token{},
+	}
+}
+
+// Load returns the tokens stored under key.
+func (store *MemoryTokenStore) Load(ctx context.Context, key string) (*Token, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	token, ok := store.tokens[key]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// Save stores a copy of token under key.
+func (store *MemoryTokenStore) Save(ctx context.Context, key string, token *Token) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.tokens[key] = *token
+	return nil
+}
+
+// FileTokenStore a TokenStore which keeps the tokens for every key in a single json file readable only by the current user.
+type FileTokenStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileTokenStore returns a new instance of a FileTokenStore backed by the file at path, which is created on the first Save.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{
+		path: path,
+	}
+}
+
+// Load returns the tokens stored under key.
+func (store *FileTokenStore) Load(ctx context.Context, key string) (*Token, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tokens, err := store.read()
+	if err != nil {
+		return nil, err
+	}
+	token, ok := tokens[key]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// Save stores token under key, rewriting the file atomically so a crash never leaves it half written.
+func (store *FileTokenStore) Save(ctx context.Context, key string, token *Token) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	tokens, err := store.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = *token
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), store.path)
+}
+
+func (store *FileTokenStore) read() (map[string]Token, error) {
+	tokens := map[string]Token{}
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return tokens, nil
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
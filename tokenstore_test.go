@@ -0,0 +1,89 @@
+package outlook
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewFileTokenStore(path)
+	ctx := context.Background()
+
+	if _, err := store.Load(ctx, "ann"); err != ErrTokenNotFound {
+		t.Errorf("Load() without a file error = %v, want ErrTokenNotFound", err)
+	}
+
+	expiry := time.Date(2024, 2, 5, 10, 0, 0, 0, time.UTC)
+	tokens := map[string]*Token{
+		"ann": {AccessToken: "ann-access", RefreshToken: "ann-refresh", Expiry: expiry},
+		"bob": {AccessToken: "bob-access", RefreshToken: "bob-refresh", Expiry: expiry.Add(time.Hour)},
+	}
+	for key, token := range tokens {
+		if err := store.Save(ctx, key, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("token file has mode %o, want 0600", mode)
+	}
+
+	// A new store reads back every key from the one file
+	reopened := NewFileTokenStore(path)
+	for key, want := range tokens {
+		got, err := reopened.Load(ctx, key)
+		if err != nil {
+			t.Fatalf("Load(%s): %v", key, err)
+		}
+		if got.AccessToken != want.AccessToken || got.RefreshToken != want.RefreshToken || !got.Expiry.Equal(want.Expiry) {
+			t.Errorf("Load(%s) = %+v, want %+v", key, got, want)
+		}
+	}
+
+	// Saving a key again replaces only its tokens
+	if err := reopened.Save(ctx, "ann", &Token{RefreshToken: "ann-rotated"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Load(ctx, "ann"); got == nil || got.RefreshToken != "ann-rotated" {
+		t.Errorf("Load(ann) after a second save = %+v", got)
+	}
+	if got, _ := store.Load(ctx, "bob"); got == nil || got.RefreshToken != "bob-refresh" {
+		t.Errorf("Load(bob) after saving ann = %+v", got)
+	}
+	if _, err := store.Load(ctx, "carol"); err != ErrTokenNotFound {
+		t.Errorf("Load() of an unknown key error = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestFileTokenStoreEmptyAndInvalidFiles(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileTokenStore(path)
+	if _, err := store.Load(ctx, "ann"); err != ErrTokenNotFound {
+		t.Errorf("Load() from an empty file error = %v, want ErrTokenNotFound", err)
+	}
+	if err := store.Save(ctx, "ann", &Token{RefreshToken: "refresh"}); err != nil {
+		t.Errorf("Save() to an empty file: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(ctx, "ann"); err == nil {
+		t.Error("Load() from an invalid file succeeded")
+	}
+	if err := store.Save(ctx, "ann", &Token{RefreshToken: "refresh"}); err == nil {
+		t.Error("Save() over an invalid file succeeded, which would drop the tokens it holds")
+	}
+}
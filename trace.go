@@ -0,0 +1,156 @@
+package outlook
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Headers microsoft uses to correlate requests, which support will ask for when investigating a failure.
+const (
+	HeaderClientRequestID       = "client-request-id"
+	HeaderReturnClientRequestID = "return-client-request-id"
+	HeaderRequestID             = "request-id"
+	HeaderDiagnostic            = "x-ms-ags-diagnostic"
+)
+
+// idSegments the path segments which are followed by the id of one of their resources.
+var idSegments = map[string]bool{
+	"users":          true,
+	"calendars":      true,
+	"calendarGroups": true,
+	"events":         true,
+	"instances":      true,
+	"mailFolders":    true,
+	"childFolders":   true,
+	"messages":       true,
+	"attachments":    true,
+}
+
+// Hook receives callbacks around every http attempt a client makes, so that adapters for tools such as opentelemetry or prometheus can be plugged in.
+// RequestStart may return a derived context, e.g. one carrying a span, which is used for the attempt and passed to RequestEnd.
+type Hook interface {
+	RequestStart(ctx context.Context, info *RequestInfo) context.Context
+	RequestEnd(ctx context.Context, info *RequestInfo)
+}
+
+// RequestInfo describes a single http attempt made by a client. The outcome fields are only filled in by the time RequestEnd is called.
+type RequestInfo struct {
+	Method          string
+	Path            string
+	PathTemplate    string
+	Attempt         int
+	ClientRequestID string
+	StatusCode      int
+	RequestID       string
+	Diagnostic      string
+	Duration        time.Duration
+	Err             error
+}
+
+// ServerResponse the http details of the response a result was decoded from, including the ids microsoft support asks for.
+type ServerResponse struct {
+	HTTPStatusCode  int         `json:"-"`
+	Header          http.Header `json:"-"`
+	RequestID       string      `json:"-"`
+	ClientRequestID string      `json:"-"`
+	Diagnostic      string      `json:"-"`
+}
+
+func (sr *ServerResponse) setServerResponse(status int, header http.Header) {
+	sr.HTTPStatusCode = status
+	sr.Header = header
+	sr.RequestID = header.Get(HeaderRequestID)
+	sr.ClientRequestID = header.Get(HeaderClientRequestID)
+	sr.Diagnostic = header.Get(HeaderDiagnostic)
+}
+
+// serverResponseSetter implemented by every result which embeds a ServerResponse.
+type serverResponseSetter interface {
+	setServerResponse(status int, header http.Header)
+}
+
+// SetClientHooks returns a ClientOpt function which adds hooks to be called around every request the client makes.
+func SetClientHooks(hooks ...Hook) ClientOpt {
+	return func(c *Client) {
+		c.hooks = append(c.hooks, hooks...)
+	}
+}
+
+// AddHooks fluent configuration of hooks to be called around every request the client makes.
+func (client *Client) AddHooks(hooks ...Hook) *Client {
+	client.hooks = append(client.hooks, hooks...)
+	return client
+}
+
+// attempt sends req once, calling the client's hooks around it.
+func (client *Client) attempt(ctx context.Context, req *http.Request, attempt int, v interface{}) (*http.Response, error) {
+	if len(client.hooks) == 0 {
+		return client.do(req.WithContext(ctx), v)
+	}
+
+	path := client.relativePath(req)
+	info := &RequestInfo{
+		Method:          req.Method,
+		Path:            path,
+		PathTemplate:    pathTemplate(path),
+		Attempt:         attempt,
+		ClientRequestID: req.Header.Get(HeaderClientRequestID),
+	}
+	attemptCtx := ctx
+	for _, hook := range client.hooks {
+		attemptCtx = hook.RequestStart(attemptCtx, info)
+	}
+
+	start := time.Now()
+	response, err := client.do(req.WithContext(attemptCtx), v)
+	info.Duration = time.Since(start)
+	info.Err = err
+	if response != nil {
+		info.StatusCode = response.StatusCode
+		info.RequestID = response.Header.Get(HeaderRequestID)
+		info.Diagnostic = response.Header.Get(HeaderDiagnostic)
+	}
+
+	for i := len(client.hooks) - 1; i >= 0; i-- {
+		client.hooks[i].RequestEnd(attemptCtx, info)
+	}
+	return response, err
+}
+
+// relativePath returns the path of req with the api's version prefix removed, when it was made to the client's graph host.
+func (client *Client) relativePath(req *http.Request) string {
+	path := req.URL.Path
+	if req.URL.Host == client.baseURL.Host {
+		path = strings.TrimPrefix(path, client.baseURL.Path)
+	}
+	return path
+}
+
+// pathTemplate replaces the ids in a path with placeholders, e.g. /users/{id}/calendars/{id}/events, so requests can be grouped by endpoint.
+func pathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if idSegments[segments[i-1]] && segments[i] != "" {
+			segments[i] = "{id}"
+		}
+	}
+	if len(segments) > 2 && segments[2] == "oauth2" {
+		segments[1] = "{tenant}"
+	}
+	return strings.Join(segments, "/")
+}
+
+// newClientRequestID returns a random uuid for correlating a request with microsoft's logs.
+func newClientRequestID() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return ""
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
@@ -0,0 +1,139 @@
+package outlook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type hookContextKey string
+
+// recordingHook a Hook which records its callbacks, along with the context values set by every recordingHook started before it.
+type recordingHook struct {
+	name   string
+	mu     *sync.Mutex
+	events *[]string
+	infos  []RequestInfo
+}
+
+func (hook *recordingHook) RequestStart(ctx context.Context, info *RequestInfo) context.Context {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	*hook.events = append(*hook.events, hook.name+" start")
+	return context.WithValue(ctx, hookContextKey(hook.name), true)
+}
+
+func (hook *recordingHook) RequestEnd(ctx context.Context, info *RequestInfo) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	event := hook.name + " end"
+	for _, name := range []string{"outer", "inner"} {
+		if ctx.Value(hookContextKey(name)) != nil {
+			event += " " + name
+		}
+	}
+	*hook.events = append(*hook.events, event)
+	hook.infos = append(hook.infos, *info)
+}
+
+func TestClientHooks(t *testing.T) {
+	var mu sync.Mutex
+	var clientRequestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		clientRequestIDs = append(clientRequestIDs, r.Header.Get(HeaderClientRequestID))
+		first := len(clientRequestIDs) == 1
+		mu.Unlock()
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set(HeaderClientRequestID, r.Header.Get(HeaderClientRequestID))
+		w.Header().Set(HeaderRequestID, "request")
+		w.Header().Set(HeaderDiagnostic, `{"ServerInfo":{"DataCenter":"West US"}}`)
+		if first {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"code":"ApplicationThrottled","message":"slow down"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"AAMk=","name":"Calendar"}`))
+	}))
+	defer server.Close()
+
+	var events []string
+	outer := &recordingHook{name: "outer", mu: &mu, events: &events}
+	inner := &recordingHook{name: "inner", mu: &mu, events: &events}
+	client, err := NewClient(
+		SetClientGraphHost(server.URL),
+		SetClientHooks(outer, inner),
+		SetClientRetryPolicy(&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := newSessionFromToken(client, &RefreshTokenResponse{AccessToken: "token"})
+
+	calendar, err := session.ForUser("ann@contoso.com").Calendars().Get("AAMk=").Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hooks start in order and end in reverse, each ending with the context every hook started with
+	want := []string{
+		"outer start", "inner start", "inner end outer inner", "outer end outer inner",
+		"outer start", "inner start", "inner end outer inner", "outer end outer inner",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("hook callbacks %q, want %q", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("hook callback %d = %q, want %q", i, events[i], want[i])
+		}
+	}
+
+	if len(inner.infos) != 2 {
+		t.Fatalf("inner hook ended %d attempts, want 2", len(inner.infos))
+	}
+	for i, info := range inner.infos {
+		if info.Attempt != i+1 || info.Method != http.MethodGet || info.Path != "/users/ann@contoso.com/calendars/AAMk=" || info.PathTemplate != "/users/{id}/calendars/{id}" {
+			t.Errorf("attempt %d described as %+v", i+1, info)
+		}
+		// Retries keep the client-request-id of the first attempt
+		if info.ClientRequestID == "" || info.ClientRequestID != clientRequestIDs[i] || info.ClientRequestID != inner.infos[0].ClientRequestID {
+			t.Errorf("attempt %d has client-request-id %q, sent %q", i+1, info.ClientRequestID, clientRequestIDs[i])
+		}
+		if info.RequestID != "request" || info.Diagnostic == "" {
+			t.Errorf("attempt %d has request id %q and diagnostic %q", i+1, info.RequestID, info.Diagnostic)
+		}
+	}
+	if first := inner.infos[0]; first.StatusCode != http.StatusTooManyRequests || first.Err == nil {
+		t.Errorf("first attempt ended with %d, %v, want the 429", first.StatusCode, first.Err)
+	}
+	if second := inner.infos[1]; second.StatusCode != http.StatusOK || second.Err != nil {
+		t.Errorf("second attempt ended with %d, %v, want a 200", second.StatusCode, second.Err)
+	}
+
+	if calendar.HTTPStatusCode != http.StatusOK || calendar.RequestID != "request" || calendar.ClientRequestID != inner.infos[1].ClientRequestID || calendar.Diagnostic == "" || calendar.Header == nil {
+		t.Errorf("calendar has server response %+v", calendar.ServerResponse)
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	for path, want := range map[string]string{
+		"/me/calendars":                                   "/me/calendars",
+		"/me/calendars/":                                  "/me/calendars/",
+		"/me/events/AAMk=/instances/AAMl=":                "/me/events/{id}/instances/{id}",
+		"/users/ann@contoso.com/calendarView":             "/users/{id}/calendarView",
+		"/me/mailFolders/inbox/messages/AAMk=":            "/me/mailFolders/{id}/messages/{id}",
+		"/me/messages/AAMk=/attachments/AAMl=":            "/me/messages/{id}/attachments/{id}",
+		"/$batch":                                         "/$batch",
+		"/common/oauth2/v2.0/token":                       "/{tenant}/oauth2/v2.0/token",
+		"/contoso.onmicrosoft.com/oauth2/v2.0/devicecode": "/{tenant}/oauth2/v2.0/devicecode",
+	} {
+		if got := pathTemplate(path); got != want {
+			t.Errorf("pathTemplate(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,39 +16,47 @@ func checkResponse(res *http.Response) error {
 		return nil
 	}
 
-	statusErr := &ErrStatusCode{Code: status}
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return err
 	}
-	if len(data) > 0 {
-		statusErr.Message = string(data)
+
+	return newErrStatusCode(status, res.Header, data)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an http date.
+func parseRetryAfter(rawRetryAfter string) time.Duration {
+	if rawRetryAfter == "" {
+		return 0
 	}
-	if statusErr.Code == 429 {
-		rawRetrySecs := res.Header.Get("Retry-After")
-		if rawRetrySecs != "" {
-			retrySecs, _ := strconv.ParseInt(rawRetrySecs, 10, 64)
-			statusErr.SuggestedRetryDuration = time.Duration(retrySecs) * time.Second
+	if retrySecs, err := strconv.ParseInt(rawRetryAfter, 10, 64); err == nil {
+		return time.Duration(retrySecs) * time.Second
+	}
+	if retryAt, err := http.ParseTime(rawRetryAfter); err == nil {
+		if delay := time.Until(retryAt); delay > 0 {
+			return delay
 		}
 	}
-
-	return statusErr
+	return 0
 }
 
-func createQueryString(params map[string]interface{}) string {
-	query := url.Values{}
+// queryValues converts the query parameters given to Session.Get and Session.Delete, formatting each value with %v.
+func queryValues(params map[string]interface{}) url.Values {
+	if params == nil {
+		return nil
+	}
+	values := url.Values{}
 	for key, val := range params {
-		query.Set(key, fmt.Sprintf("%v", val))
+		values.Set(key, fmt.Sprintf("%v", val))
 	}
-	finalQuery := query.Encode()
+	return values
+}
+
+// createQueryString encodes params as a query string, with spaces encoded as %20 since graph reads a + in an OData expression literally.
+func createQueryString(params url.Values) string {
+	finalQuery := strings.ReplaceAll(params.Encode(), "+", "%20")
 	if finalQuery == "" {
 		return ""
 	}
 	return fmt.Sprintf("?%s", finalQuery)
 }
-
-func parsePageLink(link, key string) string {
-	parsed, _ := url.Parse(link)
-	q := parsed.Query()
-	return q.Get(key)
-}